@@ -0,0 +1,393 @@
+package properties
+
+import (
+	"context"
+	"sync"
+)
+
+// CopyOnWrite is a MutableProperties which shares an immutable base for reads and copies the base into a local
+// collection on the first mutation, so that many goroutines can apply local tweaks to the same base cheaply
+type CopyOnWrite struct {
+	factory Factory
+	options []interface{}
+	base    Properties
+	mu      sync.RWMutex
+	local   MutableProperties
+}
+
+// NewCopyOnWrite returns a copy-on-write collection over base; the options (e.g. policies and events) are used
+// when the local collection is created by factory
+func NewCopyOnWrite(ctx context.Context, factory Factory, base Properties, options ...interface{}) *CopyOnWrite {
+	return &CopyOnWrite{factory: factory, options: options, base: base}
+}
+
+// current returns the collection reads should go to, the local copy once it exists or the shared base
+func (c *CopyOnWrite) current() Properties {
+	props, _ := c.reading()
+	return props
+}
+
+// reading returns the collection reads should go to and true if it's the shared base, whose properties are handed
+// out as detached copies so that e.g. SetAnyValue on a read property can't change the base
+func (c *CopyOnWrite) reading() (Properties, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.local != nil {
+		return c.local, false
+	}
+	return c.base, true
+}
+
+// detachAll replaces each of the properties with a detached copy
+func detachAll(props []Property) []Property {
+	for i, prop := range props {
+		props[i] = detach(prop)
+	}
+	return props
+}
+
+// own returns the local collection, copying the base into it on first use; the inherited properties are copied
+// without consulting the add policy or notifying observers (unless the factory doesn't create Default collections),
+// so only the local mutation itself is announced
+func (c *CopyOnWrite) own(ctx context.Context) (MutableProperties, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.local != nil {
+		return c.local, nil
+	}
+
+	local := c.factory.EmptyMutable(ctx, c.options...)
+	quiet, isDefault := local.(*Default)
+	var err error
+	c.base.Range(ctx, func(ctx context.Context, prop Property) bool {
+		if isDefault {
+			_, _, err = quiet.put(ctx, detach(prop))
+		} else {
+			_, _, err = local.AddProperty(ctx, prop, c.options...)
+		}
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.local = local
+	return local, nil
+}
+
+// Copied returns true once the base has been copied because of a local mutation
+func (c *CopyOnWrite) Copied(context.Context) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.local != nil
+}
+
+// List returns all the properties as a slice
+func (c *CopyOnWrite) List(ctx context.Context, options ...interface{}) []Property {
+	props, shared := c.reading()
+	if shared {
+		return detachAll(props.List(ctx, options...))
+	}
+	return props.List(ctx, options...)
+}
+
+// Keys returns the property names in insertion order
+func (c *CopyOnWrite) Keys(ctx context.Context) []PropertyName {
+	return c.current().Keys(ctx)
+}
+
+// Values returns the property values in insertion order
+func (c *CopyOnWrite) Values(ctx context.Context) []interface{} {
+	return c.current().Values(ctx)
+}
+
+// Into appends all the properties into the given slice and returns it
+func (c *CopyOnWrite) Into(ctx context.Context, dst []Property, options ...interface{}) []Property {
+	props, shared := c.reading()
+	if shared {
+		start := len(dst)
+		dst = props.Into(ctx, dst, options...)
+		detachAll(dst[start:])
+		return dst
+	}
+	return props.Into(ctx, dst, options...)
+}
+
+// Map returns all the properties as a map
+func (c *CopyOnWrite) Map(ctx context.Context, dest map[string]interface{}, assign MapAssignFunc, options ...interface{}) uint {
+	return c.current().Map(ctx, dest, assign, options...)
+}
+
+// MapSafe returns all the properties assigned into a freshly allocated map
+func (c *CopyOnWrite) MapSafe(ctx context.Context, assign MapAssignFunc, options ...interface{}) (map[string]interface{}, uint) {
+	return c.current().MapSafe(ctx, assign, options...)
+}
+
+// MapOrdered returns the name and value of each property in insertion order
+func (c *CopyOnWrite) MapOrdered(ctx context.Context, options ...interface{}) []KeyValue {
+	return c.current().MapOrdered(ctx, options...)
+}
+
+// Named returns the named property and true if it was found, false if not
+func (c *CopyOnWrite) Named(ctx context.Context, name PropertyName) (Property, bool) {
+	props, shared := c.reading()
+	prop, ok := props.Named(ctx, name)
+	if ok && shared {
+		return detach(prop), true
+	}
+	return prop, ok
+}
+
+// Has returns true if the named property exists
+func (c *CopyOnWrite) Has(ctx context.Context, name PropertyName) bool {
+	return c.current().Has(ctx, name)
+}
+
+// Filter returns the list of properties which match the filter criteria
+func (c *CopyOnWrite) Filter(ctx context.Context, filter func(context.Context, Property) bool, options ...interface{}) []Property {
+	props, shared := c.reading()
+	if shared {
+		return detachAll(props.Filter(ctx, func(ctx context.Context, prop Property) bool {
+			return filter(ctx, detach(prop))
+		}, options...))
+	}
+	return props.Filter(ctx, filter, options...)
+}
+
+// FilterWhile returns the properties fn includes, stopping as soon as fn says not to keep going
+func (c *CopyOnWrite) FilterWhile(ctx context.Context, fn FilterWhileFunc, options ...interface{}) []Property {
+	props, shared := c.reading()
+	if shared {
+		return detachAll(props.FilterWhile(ctx, func(ctx context.Context, prop Property) (bool, bool) {
+			return fn(ctx, detach(prop))
+		}, options...))
+	}
+	return props.FilterWhile(ctx, fn, options...)
+}
+
+// FilterByType returns the properties of the given kind
+func (c *CopyOnWrite) FilterByType(ctx context.Context, kind PropertyKind, options ...interface{}) []Property {
+	props, shared := c.reading()
+	if shared {
+		return detachAll(props.FilterByType(ctx, kind, options...))
+	}
+	return props.FilterByType(ctx, kind, options...)
+}
+
+// FilterMap returns the projected values of the properties which match the filter criteria
+func (c *CopyOnWrite) FilterMap(ctx context.Context, fn func(context.Context, Property) (interface{}, bool), options ...interface{}) []interface{} {
+	props, shared := c.reading()
+	if shared {
+		return props.FilterMap(ctx, func(ctx context.Context, prop Property) (interface{}, bool) {
+			return fn(ctx, detach(prop))
+		}, options...)
+	}
+	return props.FilterMap(ctx, fn, options...)
+}
+
+// Range runs the do function on all entries
+func (c *CopyOnWrite) Range(ctx context.Context, do func(context.Context, Property) bool, options ...interface{}) {
+	props, shared := c.reading()
+	if shared {
+		props.Range(ctx, func(ctx context.Context, prop Property) bool {
+			return do(ctx, detach(prop))
+		}, options...)
+		return
+	}
+	props.Range(ctx, do, options...)
+}
+
+// MarshalJSON implements json.Marshaler, see ToJSON
+func (c *CopyOnWrite) MarshalJSON() ([]byte, error) {
+	return ToJSON(context.Background(), c)
+}
+
+// Size returns the number of items in the list
+func (c *CopyOnWrite) Size(ctx context.Context) uint {
+	return c.current().Size(ctx)
+}
+
+// CountBy tallies the properties by the key the keyFn returns for each
+func (c *CopyOnWrite) CountBy(ctx context.Context, keyFn func(context.Context, Property) string, options ...interface{}) map[string]uint {
+	props, shared := c.reading()
+	if shared {
+		return props.CountBy(ctx, func(ctx context.Context, prop Property) string {
+			return keyFn(ctx, detach(prop))
+		}, options...)
+	}
+	return props.CountBy(ctx, keyFn, options...)
+}
+
+// EqualIgnoring returns true if both collections have equal properties, not counting the ignored names
+func (c *CopyOnWrite) EqualIgnoring(ctx context.Context, other Properties, ignore ...PropertyName) bool {
+	return c.current().EqualIgnoring(ctx, other, ignore...)
+}
+
+// HasListValue returns true if the named TextListProperty contains the value
+func (c *CopyOnWrite) HasListValue(ctx context.Context, name PropertyName, value string, options ...interface{}) bool {
+	return c.current().HasListValue(ctx, name, value, options...)
+}
+
+// ChangedSince returns the properties which are new or whose value differs from the same-named baseline property
+func (c *CopyOnWrite) ChangedSince(ctx context.Context, baseline Properties) []Property {
+	props, shared := c.reading()
+	if shared {
+		return detachAll(props.ChangedSince(ctx, baseline))
+	}
+	return props.ChangedSince(ctx, baseline)
+}
+
+// RemovedSince returns the names of the baseline properties which are no longer in this collection
+func (c *CopyOnWrite) RemovedSince(ctx context.Context, baseline Properties) []PropertyName {
+	return c.current().RemovedSince(ctx, baseline)
+}
+
+// AddMap adds all the items in the given map
+func (c *CopyOnWrite) AddMap(ctx context.Context, items map[string]interface{}, allow AllowAddFunc, options ...interface{}) (uint, error) {
+	local, err := c.own(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return local.AddMap(ctx, items, allow, options...)
+}
+
+// AddTextMap adds all the items in the given map by trying to "smart parse" the text
+func (c *CopyOnWrite) AddTextMap(ctx context.Context, items map[string]string, allow AllowAddTextFunc, options ...interface{}) (uint, error) {
+	local, err := c.own(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return local.AddTextMap(ctx, items, allow, options...)
+}
+
+// AddAnyChecked adds a single named property of any value type
+func (c *CopyOnWrite) AddAnyChecked(ctx context.Context, name string, value interface{}, allow AllowAddFunc, options ...interface{}) (Property, bool, error) {
+	local, err := c.own(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	return local.AddAnyChecked(ctx, name, value, allow, options...)
+}
+
+// AddChecked is an alias of AddAnyChecked
+func (c *CopyOnWrite) AddChecked(ctx context.Context, name string, value interface{}, allow AllowAddFunc, options ...interface{}) (Property, bool, error) {
+	return c.AddAnyChecked(ctx, name, value, allow, options...)
+}
+
+// AddParsedChecked adds a single named property of a text value by "smart parsing" the value type
+func (c *CopyOnWrite) AddParsedChecked(ctx context.Context, name string, value string, allow AllowAddTextFunc, options ...interface{}) (Property, bool, error) {
+	local, err := c.own(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	return local.AddParsedChecked(ctx, name, value, allow, options...)
+}
+
+// AddAny adds a single named property of any value type
+func (c *CopyOnWrite) AddAny(ctx context.Context, name string, value interface{}, options ...interface{}) (Property, bool, error) {
+	return c.AddAnyChecked(ctx, name, value, nil, options...)
+}
+
+// Add is an alias of AddAny
+func (c *CopyOnWrite) Add(ctx context.Context, name string, value interface{}, options ...interface{}) (Property, bool, error) {
+	return c.AddAny(ctx, name, value, options...)
+}
+
+// AddParsed adds a single named property of a text value by "smart parsing" the value type
+func (c *CopyOnWrite) AddParsed(ctx context.Context, name string, value string, options ...interface{}) (Property, bool, error) {
+	return c.AddParsedChecked(ctx, name, value, nil, options...)
+}
+
+// AddProperty adds the given property into the local collection
+func (c *CopyOnWrite) AddProperty(ctx context.Context, prop Property, options ...interface{}) (Property, bool, error) {
+	local, err := c.own(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	return local.AddProperty(ctx, prop, options...)
+}
+
+// AddProperties adds the given properties into the local collection
+func (c *CopyOnWrite) AddProperties(ctx context.Context, props []Property, options ...interface{}) (uint, error) {
+	local, err := c.own(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return local.AddProperties(ctx, props, options...)
+}
+
+// DeleteProperty removes the property
+func (c *CopyOnWrite) DeleteProperty(ctx context.Context, prop Property, options ...interface{}) (bool, error) {
+	return c.Delete(ctx, prop.Name(ctx), options...)
+}
+
+// Delete removes the property with the given name, the base is only copied if the name exists
+func (c *CopyOnWrite) Delete(ctx context.Context, name PropertyName, options ...interface{}) (bool, error) {
+	if !c.Has(ctx, name) {
+		return false, nil
+	}
+	local, err := c.own(ctx)
+	if err != nil {
+		return false, err
+	}
+	return local.Delete(ctx, name, options...)
+}
+
+// Clear removes all the properties, the base is only copied if it has any
+func (c *CopyOnWrite) Clear(ctx context.Context, options ...interface{}) uint {
+	if c.Size(ctx) == 0 {
+		return 0
+	}
+	local, err := c.own(ctx)
+	if err != nil {
+		return 0
+	}
+	return local.Clear(ctx, options...)
+}
+
+// Recount repairs the size of the local collection; the shared base isn't touched, so its size is returned as is
+func (c *CopyOnWrite) Recount(ctx context.Context) uint {
+	c.mu.RLock()
+	local := c.local
+	c.mu.RUnlock()
+	if local == nil {
+		return c.Size(ctx)
+	}
+	return local.Recount(ctx)
+}
+
+// BatchEvents buffers change events of the local collection until the returned flush function is called
+func (c *CopyOnWrite) BatchEvents(ctx context.Context) func() {
+	local, err := c.own(ctx)
+	if err != nil {
+		return func() {}
+	}
+	return local.BatchEvents(ctx)
+}
+
+// Merge copies the properties of other into the local collection, see Default.Merge for the semantics
+func (c *CopyOnWrite) Merge(ctx context.Context, other Properties, resolve MergeConflictFunc, options ...interface{}) (uint, error) {
+	local, err := c.own(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return local.Merge(ctx, other, resolve, options...)
+}
+
+// RangeMutable runs the do function on the local collection, deleting the properties it doesn't keep
+func (c *CopyOnWrite) RangeMutable(ctx context.Context, do func(context.Context, Property) (bool, error), options ...interface{}) (uint, error) {
+	local, err := c.own(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return local.RangeMutable(ctx, do, options...)
+}
+
+// Clone returns an independent copy-on-write collection, sharing the base until either collection is mutated
+func (c *CopyOnWrite) Clone(ctx context.Context) MutableProperties {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.local != nil {
+		return NewCopyOnWrite(ctx, c.factory, c.local.Clone(ctx), c.options...)
+	}
+	return NewCopyOnWrite(ctx, c.factory, c.base, c.options...)
+}
@@ -0,0 +1,116 @@
+package properties
+
+import (
+	"context"
+)
+
+// ChangeKind classifies a PropertyChange
+type ChangeKind int
+
+const (
+	// ChangeAdded means the property was added
+	ChangeAdded ChangeKind = iota + 1
+
+	// ChangeDeleted means the property was deleted
+	ChangeDeleted
+
+	// ChangeUpdated means the property replaced a stored property of the same name
+	ChangeUpdated
+)
+
+// PropertyChange describes a single change to a properties collection
+type PropertyChange struct {
+	Kind     ChangeKind
+	Property Property
+
+	// Previous is the replaced property for ChangeUpdated
+	Previous Property
+}
+
+// PropertiesChangedEvent announces changes to a collection, one change at a time or coalesced by BatchEvents
+type PropertiesChangedEvent interface {
+	PropertiesChanged(context.Context, []PropertyChange)
+}
+
+// pendingChange is a change along with the options passed to the mutation which caused it
+type pendingChange struct {
+	change  PropertyChange
+	options []interface{}
+}
+
+// BatchEvents starts buffering change events until the returned flush function is called, which delivers them as a
+// single PropertiesChanged call; AddPropertyEvent, UpdatePropertyEvent and DeletePropertyEvent observers are
+// notified on flush too, each with the options of its own change. Batches may be nested, the outermost flush
+// delivers the events.
+func (p *Default) BatchEvents(ctx context.Context) func() {
+	p.batchMu.Lock()
+	p.batchDepth++
+	p.batchMu.Unlock()
+
+	flushed := false
+	return func() {
+		p.batchMu.Lock()
+		if flushed {
+			p.batchMu.Unlock()
+			return
+		}
+		flushed = true
+		p.batchDepth--
+		if p.batchDepth > 0 {
+			p.batchMu.Unlock()
+			return
+		}
+		batch := p.batch
+		p.batch = nil
+		p.batchMu.Unlock()
+
+		if len(batch) > 0 {
+			p.deliver(ctx, batch)
+		}
+	}
+}
+
+// notify delivers the change immediately or buffers it when events are being batched
+func (p *Default) notify(ctx context.Context, change PropertyChange, options ...interface{}) {
+	p.batchMu.Lock()
+	if p.batchDepth > 0 {
+		p.batch = append(p.batch, pendingChange{change, options})
+		p.batchMu.Unlock()
+		return
+	}
+	p.batchMu.Unlock()
+
+	p.deliver(ctx, []pendingChange{{change, options}})
+}
+
+func (p *Default) deliver(ctx context.Context, pending []pendingChange) {
+	changes := make([]PropertyChange, len(pending))
+	for i, item := range pending {
+		change := item.change
+		changes[i] = change
+		switch {
+		case change.Kind == ChangeAdded && p.addEvent != nil:
+			p.addEvent.PropertyAdded(ctx, change.Property, item.options...)
+		case change.Kind == ChangeDeleted && p.deleteEvent != nil:
+			p.deleteEvent.PropertyDeleted(ctx, change.Property, item.options...)
+		case change.Kind == ChangeUpdated:
+			p.deliverUpdate(ctx, change, item.options...)
+		}
+	}
+	if p.changedEvent != nil {
+		p.changedEvent.PropertiesChanged(ctx, changes)
+	}
+}
+
+// deliverUpdate announces a replacement through UpdatePropertyEvent; an AddPropertyEvent observer which doesn't
+// implement UpdatePropertyEvent is still told about the replacement as an add, as it was before updates existed
+func (p *Default) deliverUpdate(ctx context.Context, change PropertyChange, options ...interface{}) {
+	if p.updateEvent != nil {
+		p.updateEvent.PropertyUpdated(ctx, change.Previous, change.Property, options...)
+	}
+	if p.addEvent != nil {
+		if _, updates := p.addEvent.(UpdatePropertyEvent); !updates {
+			p.addEvent.PropertyAdded(ctx, change.Property, options...)
+		}
+	}
+}
@@ -3,15 +3,45 @@ package properties
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/BurntSushi/toml"
 	"github.com/araddon/dateparse"
 	"gopkg.in/yaml.v2"
 	"io"
+	"math/big"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 )
 
+const tomlFrontMatterFence = "+++"
+
+var (
+	// ErrDegradedFrontMatter is returned (wrapped) along with the properties when front matter couldn't be decoded
+	// as YAML and only simple "key: value" lines were salvaged as text
+	ErrDegradedFrontMatter = errors.New("front matter was only partially parsed")
+
+	// ErrUnterminatedFrontMatter is returned (wrapped) when the opening front matter fence has no closing fence
+	ErrUnterminatedFrontMatter = errors.New("front matter has no closing fence")
+
+	// ErrGluedClosingFence is returned (wrapped) when the closing fence is glued onto the end of a line, e.g.
+	// "key: value---"
+	ErrGluedClosingFence = errors.New("front matter closing fence is missing a preceding newline")
+
+	// ErrFrontMatterStart is returned (wrapped) with StrictFrontMatterStart when the content doesn't start with the
+	// opening fence
+	ErrFrontMatterStart = errors.New("front matter must start with the opening fence")
+
+	// ErrNilItems is returned when a nil map is passed to create properties from
+	ErrNilItems = errors.New("items is nil")
+
+	// ErrUnknownPropertyType is returned (wrapped) when a value has no typed property and no custom creator handles it
+	ErrUnknownPropertyType = errors.New("property type is not known")
+)
+
 var (
 	// ThePropertyFactory is primary property factory for common use cases
 	ThePropertyFactory = &DefaultPropertyFactory{}
@@ -50,24 +80,44 @@ type Factory interface {
 	ImmutableFromStringMap(context.Context, map[string]interface{}, AllowAddFunc, ...interface{}) (Properties, uint, error)
 	MutableFromStringMap(context.Context, map[string]interface{}, AllowAddFunc, ...interface{}) (MutableProperties, uint, error)
 	MutableFromFrontMatter(context.Context, []byte, AllowAddFunc, ...interface{}) ([]byte, MutableProperties, uint, error)
+	MutableFromFrontMatterInto(context.Context, []byte, interface{}, AllowAddFunc, ...interface{}) ([]byte, MutableProperties, uint, error)
+	DecodeFrontMatter(context.Context, []byte, ...interface{}) ([]byte, map[string]interface{}, error)
+	StreamFromStringMap(context.Context, map[string]interface{}, StreamPropertyFunc, ...interface{}) error
+	RebuildFrom(context.Context, []Property, ...interface{}) (MutableProperties, uint, error)
+	MutableFromJSON(context.Context, []byte, AllowAddFunc, ...interface{}) (MutableProperties, uint, error)
 }
 
+// StreamPropertyFunc receives each property created by Factory.StreamFromStringMap
+type StreamPropertyFunc func(context.Context, Property) error
+
 // DefaultPropertyFactory is the default instance
 type DefaultPropertyFactory struct {
 	CustomCreatorFunc   CustomCreatorFunc
 	CustomCreator       CustomCreatorHandler
 	AfterCreateHookFunc AfterCreateHookFunc
 	AfterCreate         AfterCreateHook
+
+	// NumberParser is tried before the default parsers when smart parsing text, unless another is passed in FromText
+	// options
+	NumberParser NumberParser
 }
 
 // FromAny takes a property name and a value, then creates a typed Property from it
 // A CustomCreatorFunc or CustomCreator may be passed in options to handle unknown (custom) property types
 func (f *DefaultPropertyFactory) FromAny(ctx context.Context, name string, v interface{}, options ...interface{}) (Property, bool, error) {
+	prop, ok, err := f.fromAny(ctx, name, v, options...)
+	return withOrigin(prop, OriginExplicit, options...), ok, err
+}
+
+func (f *DefaultPropertyFactory) fromAny(ctx context.Context, name string, v interface{}, options ...interface{}) (Property, bool, error) {
 	switch value := v.(type) {
 	case string:
-		return f.afterSuccessfulCreate(ctx, &DefaultTextProperty{PropertyName(name), value}, options...)
+		if list, ok := splitTextList(name, value, options...); ok {
+			return f.fromAny(ctx, name, list, options...)
+		}
+		return f.afterSuccessfulCreate(ctx, &DefaultTextProperty{PropertyName(name), normalizeText(value, options...)}, options...)
 	case []string:
-		return f.afterSuccessfulCreate(ctx, &DefaultTextListProperty{PropertyName(name), value}, options...)
+		return f.afterSuccessfulCreate(ctx, &DefaultTextListProperty{PropertyName(name), normalizeTextList(value, options...)}, options...)
 	case time.Time:
 		return f.afterSuccessfulCreate(ctx, &DefaultDateTimeProperty{PropertyName(name), value}, options...)
 	case bool:
@@ -76,26 +126,414 @@ func (f *DefaultPropertyFactory) FromAny(ctx context.Context, name string, v int
 		return f.afterSuccessfulCreate(ctx, &DefaultCardinalProperty{PropertyName(name), int64(value)}, options...)
 	case int64:
 		return f.afterSuccessfulCreate(ctx, &DefaultCardinalProperty{PropertyName(name), value}, options...)
+	case time.Duration:
+		return f.afterSuccessfulCreate(ctx, &DefaultDurationProperty{PropertyName(name), value}, options...)
+	case *url.URL:
+		return f.afterSuccessfulCreate(ctx, &DefaultURLProperty{PropertyName(name), value}, options...)
+	case *big.Int:
+		return f.afterSuccessfulCreate(ctx, &DefaultBigIntProperty{PropertyName(name), value}, options...)
+	case []int64:
+		return f.afterSuccessfulCreate(ctx, &DefaultCardinalListProperty{PropertyName(name), value}, options...)
+	case []float64:
+		return f.afterSuccessfulCreate(ctx, &DefaultFloatListProperty{PropertyName(name), value}, options...)
+	case map[string]interface{}:
+		return f.fromNestedMap(ctx, name, value, options...)
+	case map[interface{}]interface{}:
+		// gopkg.in/yaml.v2 decodes nested mappings with interface{} keys
+		items, convErr := StringKeyedMap(value)
+		if convErr == nil {
+			return f.fromNestedMap(ctx, name, items, options...)
+		}
+		prop, ok, err := f.handleUnknownType(ctx, name, v, options...)
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: unable to add %q property: %v", ErrUnknownPropertyType, name, convErr)
+		}
+		return prop, ok, nil
+	case NumericText:
+		return f.afterSuccessfulCreate(ctx, &DefaultNumericTextProperty{PropertyName(name), value}, options...)
+	case []interface{}:
+		// decoded sequences (e.g. YAML tags: [a, b]) become typed lists when their elements allow it
+		if typed, ok := typedSlice(value); ok {
+			return f.fromAny(ctx, name, typed, options...)
+		}
+		return f.handleUnknownType(ctx, name, v, options...)
 	default:
 		return f.handleUnknownType(ctx, name, v, options...)
 	}
 }
 
+// TextNormalizer may be passed in FromAny and FromText options to normalize text (e.g. lowercase tags) before it's
+// stored, so that downstream comparison and deduplication are consistent
+type TextNormalizer struct {
+	Normalize func(string) string
+
+	// IncludeText applies the normalizer to single text values as well as text list elements
+	IncludeText bool
+}
+
+// TextListOption may be passed in FromAny and FromText options to control how text lists are stored
+type TextListOption int
+
+const (
+	// DedupeTextList removes repeated text list elements (after any normalization), keeping the first occurrence
+	DedupeTextList TextListOption = iota + 1
+)
+
+func normalizeText(value string, options ...interface{}) string {
+	for _, option := range options {
+		if instance, ok := option.(TextNormalizer); ok && instance.IncludeText && instance.Normalize != nil {
+			value = instance.Normalize(value)
+		}
+	}
+	return value
+}
+
+func normalizeTextList(values []string, options ...interface{}) []string {
+	var normalizers []func(string) string
+	dedupe := false
+	for _, option := range options {
+		switch instance := option.(type) {
+		case TextNormalizer:
+			if instance.Normalize != nil {
+				normalizers = append(normalizers, instance.Normalize)
+			}
+		case TextListOption:
+			dedupe = dedupe || instance == DedupeTextList
+		}
+	}
+	if len(normalizers) == 0 && !dedupe {
+		return values
+	}
+
+	result := make([]string, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		for _, normalize := range normalizers {
+			value = normalize(value)
+		}
+		if dedupe {
+			if seen[value] {
+				continue
+			}
+			seen[value] = true
+		}
+		result = append(result, value)
+	}
+	return result
+}
+
+// CoercionWarningFunc may be passed in FromText options, it's called whenever a text value was coerced into a typed
+// property whose textual representation wouldn't reproduce the original text (e.g. "007" into cardinal 7)
+type CoercionWarningFunc func(name string, original string, coerced Property)
+
 // FromText takes a property name and attempts to create typed properties from a text value
 func (f *DefaultPropertyFactory) FromText(ctx context.Context, name string, value string, options ...interface{}) (Property, bool, error) {
-	if flag, err := strconv.ParseBool(value); err == nil {
-		return f.FromAny(ctx, name, flag, options...)
+	prop, ok, err := f.fromText(ctx, name, value, options...)
+	if err == nil && ok {
+		for _, option := range options {
+			if fn, isWarning := option.(CoercionWarningFunc); isWarning && isLossyCoercion(ctx, value, prop) {
+				fn(name, value, prop)
+			}
+		}
+	}
+	return withOrigin(prop, OriginParsed, options...), ok, err
+}
+
+// TextListSplit may be passed in FromText options to turn delimited text like "a, b, c" into a TextListProperty; it
+// also applies to plain strings passed to FromAny, e.g. "tags: a, b, c" in front matter. Text without the delimiter,
+// or with only empty elements, stays a TextProperty, and text is never split unless this option is passed.
+type TextListSplit struct {
+	Delimiter string
+
+	// Names limits splitting to the given property names, all names are eligible when it's empty
+	Names []PropertyName
+}
+
+// split returns the trimmed, non-empty elements of value if the named property is eligible and value is delimited
+func (s TextListSplit) split(name string, value string) ([]string, bool) {
+	if s.Delimiter == "" || !strings.Contains(value, s.Delimiter) {
+		return nil, false
+	}
+	if len(s.Names) > 0 {
+		eligible := false
+		for _, n := range s.Names {
+			if string(n) == name {
+				eligible = true
+				break
+			}
+		}
+		if !eligible {
+			return nil, false
+		}
+	}
+
+	var result []string
+	for _, element := range strings.Split(value, s.Delimiter) {
+		if element = strings.TrimSpace(element); element != "" {
+			result = append(result, element)
+		}
+	}
+	return result, len(result) > 0
+}
+
+// splitTextList returns the elements of value split by the first TextListSplit in options which applies
+func splitTextList(name string, value string, options ...interface{}) ([]string, bool) {
+	for _, option := range options {
+		if instance, ok := option.(TextListSplit); ok {
+			if list, ok := instance.split(name, value); ok {
+				return list, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// RelativeDates may be passed in FromText options to recognize relative date expressions like "yesterday" or
+// "2 days ago", resolved against a Clock passed in options or Now(ctx); unrecognized expressions fall through to
+// the other parsers
+type RelativeDates struct {
+	// Named maps fixed expressions like "yesterday" to their offset from now
+	Named map[string]time.Duration
+
+	// Units maps the unit names of "<n> <unit>(s) ago" expressions to their duration
+	Units map[string]time.Duration
+}
+
+// DefaultRelativeDates recognizes today, yesterday, tomorrow and "<n> <unit>(s) ago" for minutes through weeks
+var DefaultRelativeDates = RelativeDates{
+	Named: map[string]time.Duration{
+		"today":     0,
+		"yesterday": -24 * time.Hour,
+		"tomorrow":  24 * time.Hour,
+	},
+	Units: map[string]time.Duration{
+		"minute": time.Minute,
+		"hour":   time.Hour,
+		"day":    24 * time.Hour,
+		"week":   7 * 24 * time.Hour,
+	},
+}
+
+// resolve returns the time the expression refers to and true if it's a recognized relative expression
+func (r RelativeDates) resolve(now time.Time, value string) (time.Time, bool) {
+	expression := strings.ToLower(strings.TrimSpace(value))
+	if offset, ok := r.Named[expression]; ok {
+		return now.Add(offset), true
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != 3 || fields[2] != "ago" {
+		return time.Time{}, false
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil || n < 0 {
+		return time.Time{}, false
+	}
+	unit, ok := r.Units[strings.TrimSuffix(fields[1], "s")]
+	if !ok {
+		return time.Time{}, false
+	}
+	return now.Add(-time.Duration(n) * unit), true
+}
+
+func (f *DefaultPropertyFactory) fromText(ctx context.Context, name string, value string, options ...interface{}) (Property, bool, error) {
+	for _, option := range options {
+		switch instance := option.(type) {
+		case TextListSplit:
+			if list, ok := instance.split(name, value); ok {
+				return f.fromAny(ctx, name, list, options...)
+			}
+		case RelativeDates:
+			if dateTime, ok := instance.resolve(nowFor(ctx, options...), value); ok {
+				return f.fromAny(ctx, name, dateTime, options...)
+			}
+		}
+	}
+
+	if link, ok := parseURL(value, options...); ok {
+		return f.fromAny(ctx, name, link, options...)
+	}
+
+	if flag, ok := parseFlag(value, options...); ok {
+		return f.fromAny(ctx, name, flag, options...)
+	}
+
+	// a configured number parser is tried before dates, since permissive date parsing would claim "9.999"
+	if parser := f.numberParser(options...); parser != nil {
+		if number, ok := parser.ParseNumber(ctx, value); ok {
+			return f.fromAny(ctx, name, number, options...)
+		}
+	}
+
+	// integers are tried before dates, since dateparse would read values like "2024" or "20240101" as timestamps
+	if number, err := parseInt(value, options...); err == nil {
+		return f.fromAny(ctx, name, number, options...)
+	} else if number, ok := parseBigInt(value, err, options...); ok {
+		return f.fromAny(ctx, name, number, options...)
+	}
+
+	if dateTime, ok := parseDate(value, options...); ok {
+		return f.fromAny(ctx, name, dateTime, options...)
+	}
+
+	if duration, ok := parseDuration(value); ok {
+		return f.fromAny(ctx, name, duration, options...)
+	}
+
+	return f.fromAny(ctx, name, value, options...)
+}
+
+// OriginOption may be passed in FromAny and FromText options to control how created properties are annotated
+type OriginOption int
+
+const (
+	// TrackOrigin wraps created properties in a DefaultOriginProperty recording whether their type was smart-parsed,
+	// explicit or custom; note the wrapper only exposes the Property methods, use Unwrap for the typed interfaces
+	TrackOrigin OriginOption = iota + 1
+)
+
+// withOrigin wraps the property when TrackOrigin is requested, keeping any origin already recorded
+func withOrigin(prop Property, origin PropertyOrigin, options ...interface{}) Property {
+	if prop == nil {
+		return prop
+	}
+	if _, tracked := prop.(*DefaultOriginProperty); tracked {
+		return prop
+	}
+	for _, option := range options {
+		if instance, ok := option.(OriginOption); ok && instance == TrackOrigin {
+			return &DefaultOriginProperty{Property: prop, From: origin}
+		}
 	}
+	return prop
+}
+
+// ParseOptions may be passed in FromText options to restrict smart parsing; by default strconv.ParseBool decides
+// what becomes a flag, so "1", "0", "t" and "F" are flags too
+type ParseOptions struct {
+	// DisableFlags never coerces text into a FlagProperty, so "1" becomes a cardinal and "true" stays text
+	DisableFlags bool
+
+	// StrictFlags only coerces exactly "true" and "false" into a FlagProperty
+	StrictFlags bool
+
+	// URLs coerces absolute http and https URLs into a URLProperty, they stay text by default
+	URLs bool
+
+	// DisableDates never coerces text into a DateTimeProperty
+	DisableDates bool
+
+	// IntegerLiterals parses integers with Go literal syntax (strconv.ParseInt base 0), so hexadecimal "0x1F",
+	// octal "0o17" and binary "0b101" become cardinals; only base 10 is parsed by default
+	IntegerLiterals bool
 
-	if dateTime, err := dateparse.ParseAny(value); err == nil {
-		return f.FromAny(ctx, name, dateTime, options...)
+	// BigInts coerces integers which are out of the int64 range into a BigIntProperty, they stay text by default
+	BigInts bool
+
+	// DateLayouts limits date parsing to the given time.Parse layouts instead of the permissive dateparse.ParseAny
+	DateLayouts []string
+}
+
+func parseURL(value string, options ...interface{}) (*url.URL, bool) {
+	for _, option := range options {
+		if instance, ok := option.(ParseOptions); ok && instance.URLs {
+			link, err := url.Parse(value)
+			if err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Host == "" {
+				return nil, false
+			}
+			return link, true
+		}
 	}
+	return nil, false
+}
 
-	if number, err := strconv.ParseInt(value, 10, 64); err == nil {
-		return f.FromAny(ctx, name, number, options...)
+func parseInt(value string, options ...interface{}) (int64, error) {
+	for _, option := range options {
+		if instance, ok := option.(ParseOptions); ok && instance.IntegerLiterals {
+			return strconv.ParseInt(value, 0, 64)
+		}
 	}
+	return strconv.ParseInt(value, 10, 64)
+}
 
-	return f.FromAny(ctx, name, value, options...)
+func parseBigInt(value string, parseErr error, options ...interface{}) (*big.Int, bool) {
+	if !errors.Is(parseErr, strconv.ErrRange) {
+		return nil, false
+	}
+	for _, option := range options {
+		if instance, ok := option.(ParseOptions); ok && instance.BigInts {
+			base := 10
+			if instance.IntegerLiterals {
+				base = 0
+			}
+			return new(big.Int).SetString(value, base)
+		}
+	}
+	return nil, false
+}
+
+func parseDate(value string, options ...interface{}) (time.Time, bool) {
+	for _, option := range options {
+		if instance, ok := option.(ParseOptions); ok {
+			if instance.DisableDates {
+				return time.Time{}, false
+			}
+			if len(instance.DateLayouts) > 0 {
+				for _, layout := range instance.DateLayouts {
+					if dateTime, err := time.Parse(layout, value); err == nil {
+						return dateTime, true
+					}
+				}
+				return time.Time{}, false
+			}
+		}
+	}
+	// dateparse reads plain numbers like "3.14" as dates, anything strconv.ParseFloat accepts is never a date
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Time{}, false
+	}
+	dateTime, err := dateparse.ParseAny(value)
+	return dateTime, err == nil
+}
+
+func parseFlag(value string, options ...interface{}) (bool, bool) {
+	for _, option := range options {
+		if instance, ok := option.(ParseOptions); ok {
+			if instance.DisableFlags {
+				return false, false
+			}
+			if instance.StrictFlags {
+				return value == "true", value == "true" || value == "false"
+			}
+		}
+	}
+	flag, err := strconv.ParseBool(value)
+	return flag, err == nil
+}
+
+// parseDuration only accepts values ending in a unit suffix (e.g. "7m" or "2h30m"), since time.ParseDuration would
+// also accept a bare "0"
+func parseDuration(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if last := value[len(value)-1]; last < 'a' || last > 'z' {
+		return 0, false
+	}
+	duration, err := time.ParseDuration(value)
+	return duration, err == nil
+}
+
+// isLossyCoercion returns true if the original text can't be reproduced from the flag or cardinal it was coerced into
+func isLossyCoercion(ctx context.Context, original string, coerced Property) bool {
+	switch value := coerced.AnyValue(ctx).(type) {
+	case bool:
+		return strconv.FormatBool(value) != original
+	case int64:
+		return strconv.FormatInt(value, 10) != original
+	default:
+		return false
+	}
 }
 
 func (f *DefaultPropertyFactory) afterSuccessfulCreate(ctx context.Context, property Property, options ...interface{}) (Property, bool, error) {
@@ -109,7 +547,17 @@ func (f *DefaultPropertyFactory) afterSuccessfulCreate(ctx context.Context, prop
 	return property, true, nil
 }
 
+// handleUnknownType creates the property through a custom creator, the after create hooks apply just like they do
+// for the known types
 func (f *DefaultPropertyFactory) handleUnknownType(ctx context.Context, name string, value interface{}, options ...interface{}) (Property, bool, error) {
+	prop, ok, err := f.createCustom(ctx, name, value, options...)
+	if err == nil && ok && prop != nil {
+		prop, ok, err = f.afterSuccessfulCreate(ctx, prop, options...)
+	}
+	return withOrigin(prop, OriginCustom, options...), ok, err
+}
+
+func (f *DefaultPropertyFactory) createCustom(ctx context.Context, name string, value interface{}, options ...interface{}) (Property, bool, error) {
 	for _, option := range options {
 		if fn, ok := option.(CustomCreatorFunc); ok {
 			return fn(ctx, name, value, options...)
@@ -125,12 +573,90 @@ func (f *DefaultPropertyFactory) handleUnknownType(ctx context.Context, name str
 	if f.CustomCreatorFunc != nil {
 		return f.CustomCreatorFunc(ctx, name, value)
 	}
-	return nil, false, fmt.Errorf("Unable to add %q property, type %T is not known: %+v", name, value, value)
+	return nil, false, fmt.Errorf("%w: unable to add %q property of type %T: %+v", ErrUnknownPropertyType, name, value, value)
+}
+
+// FrontMatterOption may be passed in options to the front matter parsers to control how values are decoded
+type FrontMatterOption int
+
+const (
+	// PreserveNumericText keeps floating point scalars like "price: 3.50" as NumericText so that their exact
+	// formatting survives serialization, instead of decoding them into float64
+	PreserveNumericText FrontMatterOption = iota + 1
+
+	// HTMLCommentFences expects front matter wrapped in an HTML comment, i.e. "<!--" and "-->" lines, instead of
+	// "---" lines
+	HTMLCommentFences
+
+	// ExplicitYAMLTags decodes front matter with YAML 1.2 semantics and honors explicit scalar tags, so that
+	// "!!bool yes" is a flag, "!!str 123" is text and "!!int 0x1F" is a cardinal while a plain "yes" stays text
+	ExplicitYAMLTags
+
+	// ResolvePropertyReferences runs ResolveReferences after loading so that templated values like
+	// "slug: {{ .title | slugify }}" are rendered from the other properties
+	ResolvePropertyReferences
+
+	// StrictFrontMatterStart requires the opening fence to be the first non-whitespace content, anything else before
+	// it (or no fence at all) is an error; by default leading lines before the opening fence are skipped
+	StrictFrontMatterStart
+
+	// LenientFrontMatterStart skips leading blank lines only, if other content comes before the opening fence the
+	// entire content is treated as body
+	LenientFrontMatterStart
+
+	// MergeYAMLDocuments keeps reading YAML documents which directly follow the front matter, each closed by its own
+	// fence (e.g. "---\na: 1\n---\nb: 2\n---\nbody"), and merges them with later keys winning; a following block
+	// which isn't a YAML mapping is body. By default only the first document is front matter.
+	MergeYAMLDocuments
+)
+
+func hasFrontMatterOption(option FrontMatterOption, options ...interface{}) bool {
+	for _, o := range options {
+		if instance, ok := o.(FrontMatterOption); ok && instance == option {
+			return true
+		}
+	}
+	return false
+}
+
+// rawYAMLScalar captures the original text of a YAML scalar, it's left empty for sequences and mappings
+type rawYAMLScalar struct {
+	text string
+	ok   bool
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (r *rawYAMLScalar) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	r.ok = unmarshal(&r.text) == nil
+	return nil
+}
+
+// preserveNumericText replaces decoded floats in items with their original text from the YAML source
+func preserveNumericText(b []byte, items map[string]interface{}) error {
+	raw := make(map[string]rawYAMLScalar)
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	for name, value := range items {
+		if _, isFloat := value.(float64); isFloat && raw[name].ok {
+			items[name] = NumericText(raw[name].text)
+		}
+	}
+	return nil
 }
 
 // DefaultPropertiesFactory is the default properties factory
 type DefaultPropertiesFactory struct {
 	PropFactory PropertyFactory
+
+	// AllowAdd and AllowAddText are the default ingestion policies of the collections this factory creates, used
+	// whenever a nil allow func is passed; an AllowAddFunc or AllowAddTextFunc in EmptyMutable options takes precedence
+	AllowAdd     AllowAddFunc
+	AllowAddText AllowAddTextFunc
+
+	// NameAlias rewrites incoming names in the collections this factory creates, unless a NameAliasFunc is passed in
+	// EmptyMutable options
+	NameAlias NameAliasFunc
 }
 
 // PropertyFactory returns the factory that is used to produce property instances
@@ -140,7 +666,17 @@ func (f *DefaultPropertiesFactory) PropertyFactory(context.Context) PropertyFact
 
 // EmptyMutable returns an empty but mutable properties instance
 func (f *DefaultPropertiesFactory) EmptyMutable(ctx context.Context, options ...interface{}) MutableProperties {
-	return newDefaultProperties(ctx, f.PropertyFactory(ctx), options...)
+	result := newDefaultProperties(ctx, f.PropertyFactory(ctx), options...)
+	if result.defaultAllow == nil {
+		result.defaultAllow = f.AllowAdd
+	}
+	if result.defaultAllowText == nil {
+		result.defaultAllowText = f.AllowAddText
+	}
+	if result.aliases == nil {
+		result.aliases = f.NameAlias
+	}
+	return result
 }
 
 // ImmutableFromStringMap returns a new Properties instance filled with the given items
@@ -153,15 +689,166 @@ func (f *DefaultPropertiesFactory) MutableFromStringMap(ctx context.Context, ite
 	return f.fromStringMap(ctx, items, allow, options...)
 }
 
-// MutableFromFrontMatter returns a new Properties instance from content that looks like a markdown file with front matter
+// MutableFromFrontMatter returns a new Properties instance from content that looks like a markdown file with front matter;
+// the format is detected with DetectFrontMatterFormat unless a FrontMatterFormat is passed in options
 func (f *DefaultPropertiesFactory) MutableFromFrontMatter(ctx context.Context, content []byte, allow AllowAddFunc, options ...interface{}) (bodyWithoutFrontMatter []byte, frontMatter MutableProperties, count uint, err error) {
-	return f.fromYAMLFrontMatter(ctx, content, allow, options...)
+	return f.MutableFromFrontMatterInto(ctx, content, nil, allow, options...)
+}
+
+// MutableFromFrontMatterInto is like MutableFromFrontMatter but also unmarshals the front matter into dest (e.g. a
+// pointer to a struct) when dest isn't nil; dest is only filled if the front matter was decoded without errors
+func (f *DefaultPropertiesFactory) MutableFromFrontMatterInto(ctx context.Context, content []byte, dest interface{}, allow AllowAddFunc, options ...interface{}) (bodyWithoutFrontMatter []byte, frontMatter MutableProperties, count uint, err error) {
+	body, items, order, err := decodeFrontMatter(content, frontMatterFormat(content, options...), dest, options...)
+	return f.fromDecodedFrontMatter(ctx, body, items, order, err, allow, options...)
+}
+
+// DecodeFrontMatter splits content into its body and the raw map its front matter decoded into (after format
+// detection and normalization) without creating any properties; raw is nil if there is no front matter
+func (f *DefaultPropertiesFactory) DecodeFrontMatter(ctx context.Context, content []byte, options ...interface{}) (body []byte, raw map[string]interface{}, err error) {
+	body, raw, _, err = decodeFrontMatter(content, frontMatterFormat(content, options...), nil, options...)
+	return body, raw, err
+}
+
+// decodeFrontMatter returns the body, the decoded items and the order their keys were declared in
+func decodeFrontMatter(content []byte, format FrontMatterFormat, dest interface{}, options ...interface{}) ([]byte, map[string]interface{}, KeyOrderTree, error) {
+	content = stripBOM(content)
+	switch format {
+	case TOMLFrontMatter:
+		return decodeTOMLFrontMatter(content, dest, options...)
+	case JSONFrontMatter:
+		return decodeJSONFrontMatter(content, dest)
+	default:
+		return decodeYAMLFrontMatter(content, dest, options...)
+	}
+}
+
+// fromDecodedFrontMatter creates the properties for decoded front matter; a degraded decode still returns the
+// salvaged properties along with its error
+func (f *DefaultPropertiesFactory) fromDecodedFrontMatter(ctx context.Context, body []byte, items map[string]interface{}, order KeyOrderTree, decodeErr error, allow AllowAddFunc, options ...interface{}) ([]byte, MutableProperties, uint, error) {
+	if items == nil {
+		return body, nil, 0, decodeErr
+	}
+	// properties are added in declaration order, the options slice is capped so the caller's isn't appended to
+	props, count, err := f.fromStringMap(ctx, items, allow, append(options[:len(options):len(options)], order)...)
+	if err == nil && hasFrontMatterOption(ResolvePropertyReferences, options...) {
+		if _, err = ResolveReferences(ctx, props, options...); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	if decodeErr != nil {
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		return body, props, count, decodeErr
+	}
+	return body, props, count, err
+}
+
+// MutableFromJSONFrontMatter returns a new Properties instance from content which starts with a JSON object followed
+// by the body, regardless of what DetectFrontMatterFormat would report
+func (f *DefaultPropertiesFactory) MutableFromJSONFrontMatter(ctx context.Context, content []byte, allow AllowAddFunc, options ...interface{}) (bodyWithoutFrontMatter []byte, frontMatter MutableProperties, count uint, err error) {
+	body, items, order, err := decodeJSONFrontMatter(content, nil)
+	return f.fromDecodedFrontMatter(ctx, body, items, order, err, allow, options...)
+}
+
+// MutableFromJSON returns a new Properties instance from a JSON object, added in declaration order; numbers are
+// decoded like JSON front matter, so integers become cardinals and other numbers keep their text as NumericText
+func (f *DefaultPropertiesFactory) MutableFromJSON(ctx context.Context, b []byte, allow AllowAddFunc, options ...interface{}) (MutableProperties, uint, error) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var items map[string]interface{}
+	if err := decoder.Decode(&items); err != nil {
+		return nil, 0, fmt.Errorf("unable to decode JSON: %w", err)
+	}
+	if decoder.More() {
+		return nil, 0, fmt.Errorf("unable to decode JSON: unexpected content after the object at byte %d", decoder.InputOffset())
+	}
+	normalizeJSONMap(items)
+	return f.fromStringMap(ctx, items, allow, append(options[:len(options):len(options)], jsonKeyOrder(b))...)
+}
+
+// FrontMatterFormat identifies how front matter is encoded; it may also be passed in front matter options to skip
+// detection and force a format
+type FrontMatterFormat int
+
+const (
+	// YAMLFrontMatter is fenced by --- (or HTML comments with HTMLCommentFences) and is the default
+	YAMLFrontMatter FrontMatterFormat = iota
+	// TOMLFrontMatter is fenced by +++
+	TOMLFrontMatter
+	// JSONFrontMatter is a leading {...} object
+	JSONFrontMatter
+)
+
+func (f FrontMatterFormat) String() string {
+	switch f {
+	case TOMLFrontMatter:
+		return "TOML"
+	case JSONFrontMatter:
+		return "JSON"
+	default:
+		return "YAML"
+	}
+}
+
+// DetectFrontMatterFormat inspects the first non-empty line of content: +++ means TOML, a leading JSON object (or
+// a { on its own line) means JSON and anything else, such as a {{< shortcode >}}, is treated as YAML
+func DetectFrontMatterFormat(content []byte) FrontMatterFormat {
+	line := firstNonEmptyLine(stripBOM(content))
+	switch {
+	case isFrontMatterFence(line, tomlFrontMatterFence):
+		return TOMLFrontMatter
+	case startsWithJSONObject(content):
+		return JSONFrontMatter
+	default:
+		return YAMLFrontMatter
+	}
+}
+
+func frontMatterFormat(content []byte, options ...interface{}) FrontMatterFormat {
+	for _, option := range options {
+		if instance, ok := option.(FrontMatterFormat); ok {
+			return instance
+		}
+	}
+	return DetectFrontMatterFormat(content)
+}
+
+// RebuildFrom returns a new Properties instance holding the given properties (e.g. from a previous List call),
+// each one is added through AddProperty so that policies and events passed in options apply
+func (f *DefaultPropertiesFactory) RebuildFrom(ctx context.Context, items []Property, options ...interface{}) (MutableProperties, uint, error) {
+	props := f.EmptyMutable(ctx, options...)
+	count, err := props.AddProperties(ctx, items, options...)
+	return props, count, err
+}
+
+// StreamFromStringMap creates a property for each of the given items and hands it to the stream function
+// immediately instead of storing it in a collection; it stops at the first error
+func (f *DefaultPropertiesFactory) StreamFromStringMap(ctx context.Context, items map[string]interface{}, stream StreamPropertyFunc, options ...interface{}) error {
+	if items == nil {
+		return ErrNilItems
+	}
+
+	pf := f.PropertyFactory(ctx)
+	for name, value := range items {
+		prop, ok, err := pf.FromAny(ctx, name, value, options...)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := stream(ctx, prop); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // FromStringMap returns a new properties instance based on a text map
 func (f *DefaultPropertiesFactory) fromStringMap(ctx context.Context, items map[string]interface{}, allow AllowAddFunc, options ...interface{}) (MutableProperties, uint, error) {
 	if items == nil {
-		return nil, 0, fmt.Errorf("items is Nil")
+		return nil, 0, ErrNilItems
 	}
 
 	props := f.EmptyMutable(ctx, options...)
@@ -169,58 +856,546 @@ func (f *DefaultPropertiesFactory) fromStringMap(ctx context.Context, items map[
 	return props, count, err
 }
 
-// fromYAMLFrontMatter will convert an input byte array like ---<stuff>---\n<body> into v as YAML and <body> as return value
-func (f *DefaultPropertiesFactory) fromYAMLFrontMatter(ctx context.Context, b []byte, allow AllowAddFunc, options ...interface{}) ([]byte, MutableProperties, uint, error) {
+// frontMatterRegion describes where the front matter and body are found within content
+type frontMatterRegion struct {
+	start     int
+	end       int
+	bodyStart int
+}
+
+// locateFrontMatter finds the front matter between the opening and closing fences; found is false if the content
+// has no front matter at all (so the entire content is body)
+func locateFrontMatter(b []byte, openingFence string, closingFence string, options ...interface{}) (region frontMatterRegion, found bool, err error) {
 	buf := bytes.NewBuffer(b)
+	strict := hasFrontMatterOption(StrictFrontMatterStart, options...)
+	lenient := hasFrontMatterOption(LenientFrontMatterStart, options...)
 
 	var insideFrontMatter bool
-	var yamlStartIndex int
-	var yamlEndIndex int
+	lineNumber := 0
 
 	for {
+		lineStartIndex := len(b) - buf.Len()
 		line, err := buf.ReadString('\n')
 
-		if err == io.EOF {
-			break
+		if err != nil && err != io.EOF {
+			return region, false, err
 		}
 
-		if err != nil {
-			return nil, nil, 0, err
+		lineNumber++
+
+		fence := openingFence
+		if insideFrontMatter {
+			fence = closingFence
 		}
 
-		if strings.TrimSpace(line) != "---" {
+		// the last line may not have a trailing newline (e.g. a closing fence with no body), so it's still checked
+		if !isFrontMatterFence(line, fence) {
+			if !insideFrontMatter && strings.TrimSpace(line) != "" {
+				if strict {
+					return region, false, fmt.Errorf("%w: expected %q, found %q on line %d", ErrFrontMatterStart, openingFence, strings.TrimSpace(line), lineNumber)
+				}
+				if lenient {
+					return region, false, nil
+				}
+			}
+			if err == io.EOF {
+				break
+			}
 			continue
 		}
 
 		if !insideFrontMatter {
 			insideFrontMatter = true
-			yamlStartIndex = len(b) - buf.Len()
+			region.start = len(b) - buf.Len()
 		} else {
-			yamlEndIndex = len(b) - buf.Len()
+			region.end = lineStartIndex
+			region.bodyStart = len(b) - buf.Len()
 			break
 		}
 	}
 
 	// if we get to here and we're not inside front matter then the entire string is body
 	if !insideFrontMatter {
-		return b, nil, 0, nil
+		if strict {
+			return region, false, fmt.Errorf("%w: expected %q, none found", ErrFrontMatterStart, openingFence)
+		}
+		return region, false, nil
+	}
+
+	if region.bodyStart == 0 {
+		if number, line, ok := findGluedFence(b, region.start, closingFence); ok {
+			return region, true, fmt.Errorf("%w: %q on line %d: %q", ErrGluedClosingFence, closingFence, number, line)
+		}
+		return region, true, fmt.Errorf("%w: %q expected after byte %d", ErrUnterminatedFrontMatter, closingFence, region.start)
+	}
+
+	return region, true, nil
+}
+
+// utf8BOM is the byte order mark some editors write at the start of UTF-8 files
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// stripBOM removes a leading UTF-8 byte order mark so that the opening fence is found on the first line and the
+// mark isn't returned as part of the body
+func stripBOM(b []byte) []byte {
+	return bytes.TrimPrefix(b, utf8BOM)
+}
+
+// normalizeLineEndings converts CRLF line endings (e.g. files saved on Windows) into LF so that multi-line values
+// and line based scanning of the front matter don't keep a stray carriage return
+func normalizeLineEndings(b []byte) []byte {
+	return bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1)
+}
+
+// firstNonEmptyLine returns the first line of b which isn't only whitespace
+func firstNonEmptyLine(b []byte) string {
+	for len(b) > 0 {
+		line := b
+		if newline := bytes.IndexByte(b, '\n'); newline >= 0 {
+			line, b = b[:newline], b[newline+1:]
+		} else {
+			b = nil
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			return string(trimmed)
+		}
 	}
+	return ""
+}
 
-	if insideFrontMatter && yamlEndIndex == 0 {
-		return nil, nil, 0, fmt.Errorf("Unexplained front matter parser error; insideFrontMatter: %v, yamlStartIndex: %v, yamlEndIndex: %v", insideFrontMatter, yamlStartIndex, yamlEndIndex)
+// decodeTOMLFrontMatter splits an input byte array like +++<stuff>+++\n<body> into <stuff> decoded as TOML and <body>
+func decodeTOMLFrontMatter(b []byte, dest interface{}, options ...interface{}) ([]byte, map[string]interface{}, KeyOrderTree, error) {
+	region, found, err := locateFrontMatter(b, tomlFrontMatterFence, tomlFrontMatterFence, options...)
+	if err != nil {
+		return nil, nil, KeyOrderTree{}, err
+	}
+	if !found {
+		return b, nil, KeyOrderTree{}, nil
 	}
 
+	frontMatter := normalizeLineEndings(b[region.start:region.end])
 	items := make(map[string]interface{})
+	meta, err := toml.Decode(string(frontMatter), &items)
+	if err != nil {
+		return nil, nil, KeyOrderTree{}, fmt.Errorf("unable to decode TOML front matter at bytes %d-%d: %w", region.start, region.end, err)
+	}
+	if dest != nil {
+		if err := toml.Unmarshal(frontMatter, dest); err != nil {
+			return nil, nil, KeyOrderTree{}, fmt.Errorf("unable to decode TOML front matter into %T: %w", dest, err)
+		}
+	}
+
+	var order KeyOrderTree
+	for _, key := range meta.Keys() {
+		order.add(key)
+	}
+	return bytes.TrimSpace(b[region.bodyStart:]), items, order, nil
+}
 
-	var props MutableProperties
-	var count uint
-	var err error
+// jsonWhitespace is the insignificant whitespace allowed before a JSON value
+const jsonWhitespace = " \t\r\n"
 
-	err = yaml.Unmarshal(b[yamlStartIndex:yamlEndIndex], items)
+// startsWithJSONObject returns true if content opens with a { on its own line or with an object that decodes
+func startsWithJSONObject(content []byte) bool {
+	content = bytes.TrimLeft(stripBOM(content), jsonWhitespace)
+	if !bytes.HasPrefix(content, []byte("{")) {
+		return false
+	}
+	if firstNonEmptyLine(content) == "{" {
+		return true
+	}
+	var object map[string]json.RawMessage
+	return json.NewDecoder(bytes.NewReader(content)).Decode(&object) == nil
+}
+
+// decodeJSONFrontMatter splits an input byte array like {<stuff>}\n<body> into <stuff> decoded as JSON and <body>;
+// content which doesn't start with { (after an optional BOM) is all body
+func decodeJSONFrontMatter(b []byte, dest interface{}) ([]byte, map[string]interface{}, KeyOrderTree, error) {
+	object := bytes.TrimLeft(stripBOM(b), jsonWhitespace)
+	if !bytes.HasPrefix(object, []byte("{")) {
+		return b, nil, KeyOrderTree{}, nil
+	}
+	start := len(b) - len(object)
+
+	// the decoder stops at the end of the balanced object so the remainder is the body
+	decoder := json.NewDecoder(bytes.NewReader(b[start:]))
+	decoder.UseNumber()
+	items := make(map[string]interface{})
+	if err := decoder.Decode(&items); err != nil {
+		return nil, nil, KeyOrderTree{}, fmt.Errorf("unable to decode JSON front matter: %w", err)
+	}
+	normalizeJSONMap(items)
+	end := start + int(decoder.InputOffset())
+	if dest != nil {
+		if err := json.Unmarshal(b[start:end], dest); err != nil {
+			return nil, nil, KeyOrderTree{}, fmt.Errorf("unable to decode JSON front matter into %T: %w", dest, err)
+		}
+	}
+
+	return bytes.TrimSpace(b[end:]), items, jsonKeyOrder(b[start:end]), nil
+}
+
+// jsonKeyOrder returns the keys of a JSON object, and of the objects nested in it, in declaration order
+func jsonKeyOrder(b []byte) KeyOrderTree {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return KeyOrderTree{}
+	}
+	return jsonObjectKeyOrder(decoder)
+}
+
+// jsonObjectKeyOrder reads the rest of an object whose opening { was already read
+func jsonObjectKeyOrder(decoder *json.Decoder) KeyOrderTree {
+	var order KeyOrderTree
+	for decoder.More() {
+		token, err := decoder.Token()
+		key, ok := token.(string)
+		if err != nil || !ok {
+			return order
+		}
+		order.Keys = append(order.Keys, key)
+
+		if token, err = decoder.Token(); err != nil {
+			return order
+		}
+		switch token {
+		case json.Delim('{'):
+			if order.Nested == nil {
+				order.Nested = make(map[string]KeyOrderTree)
+			}
+			order.Nested[key] = jsonObjectKeyOrder(decoder)
+		case json.Delim('['):
+			skipJSONArray(decoder)
+		}
+	}
+	decoder.Token() // the closing }
+	return order
+}
+
+// skipJSONArray reads the rest of an array whose opening [ was already read
+func skipJSONArray(decoder *json.Decoder) {
+	for depth := 1; depth > 0; {
+		token, err := decoder.Token()
+		if err != nil {
+			return
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
+
+// fromNestedMap recursively builds a NestedProperty whose children are created by this factory
+func (f *DefaultPropertyFactory) fromNestedMap(ctx context.Context, name string, items map[string]interface{}, options ...interface{}) (Property, bool, error) {
+	nested := newDefaultProperties(ctx, f)
+	if _, err := nested.AddMap(ctx, items, nil, nestedOptions(name, options...)...); err != nil {
+		return nil, false, fmt.Errorf("unable to create nested property %q: %w", name, err)
+	}
+	return f.afterSuccessfulCreate(ctx, &DefaultNestedProperty{PropertyName(name), nested}, options...)
+}
+
+// nestedOptions returns the options which apply to the items of the named nested map: the options which address
+// top-level keys (KeyOrder, AliasGroup, TextListSplit and AddMapOption) are dropped and a KeyOrderTree is narrowed
+// to the nested map's own order
+func nestedOptions(name string, options ...interface{}) []interface{} {
+	result := make([]interface{}, 0, len(options))
+	for _, option := range options {
+		switch instance := option.(type) {
+		case KeyOrder, AliasGroup, TextListSplit, AddMapOption:
+			continue
+		case KeyOrderTree:
+			if nested, ok := instance.Nested[name]; ok {
+				result = append(result, nested)
+			}
+		default:
+			result = append(result, option)
+		}
+	}
+	return result
+}
+
+// StringKeyedMap converts a map decoded by gopkg.in/yaml.v2, which has interface{} keys, into a string map; nested
+// maps, including those inside sequences, are converted too. An error is returned if any key isn't a string.
+func StringKeyedMap(values map[interface{}]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		text, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("map key %v is %T, only string keys are supported", key, key)
+		}
+		converted, err := stringKeyedValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", text, err)
+		}
+		result[text] = converted
+	}
+	return result, nil
+}
+
+// stringKeyedValue converts the interface{} keyed maps within a decoded value
+func stringKeyedValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		return StringKeyedMap(v)
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, element := range v {
+			converted, err := stringKeyedValue(element)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = converted
+		}
+		return result, nil
+	default:
+		return value, nil
+	}
+}
+
+// typedSlice converts a decoded array whose elements are all text, all integers or all numbers into a []string,
+// []int64 or []float64 respectively; an empty array becomes an empty []string
+func typedSlice(values []interface{}) (interface{}, bool) {
+	if len(values) == 0 {
+		return []string{}, true
+	}
+
+	var texts []string
+	var ints []int64
+	var floats []float64
+	for _, value := range values {
+		switch v := value.(type) {
+		case string:
+			texts = append(texts, v)
+		case int:
+			ints = append(ints, int64(v))
+			floats = append(floats, float64(v))
+		case int64:
+			ints = append(ints, v)
+			floats = append(floats, float64(v))
+		case float64:
+			floats = append(floats, v)
+		case json.Number:
+			if i, err := v.Int64(); err == nil {
+				ints = append(ints, i)
+				floats = append(floats, float64(i))
+			} else if f, err := v.Float64(); err == nil {
+				floats = append(floats, f)
+			}
+		}
+	}
+
+	switch len(values) {
+	case len(texts):
+		return texts, true
+	case len(ints):
+		return ints, true
+	case len(floats):
+		return floats, true
+	}
+	return nil, false
+}
+
+// normalizeJSONMap replaces JSON numbers with int64 when they have no fractional part (so "number": 221 becomes a
+// cardinal like it would in YAML) and NumericText otherwise, and turns homogeneous arrays into typed slices
+func normalizeJSONMap(items map[string]interface{}) {
+	for key, value := range items {
+		items[key] = normalizeJSONValue(value)
+	}
+}
+
+func normalizeJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		return NumericText(v)
+	case map[string]interface{}:
+		normalizeJSONMap(v)
+		return v
+	case []interface{}:
+		return normalizeJSONArray(v)
+	default:
+		return value
+	}
+}
+
+func normalizeJSONArray(values []interface{}) interface{} {
+	if typed, ok := typedSlice(values); ok {
+		return typed
+	}
+
+	// mixed arrays are left for a custom creator to handle
+	for i, value := range values {
+		values[i] = normalizeJSONValue(value)
+	}
+	return values
+}
+
+// decodeYAMLDocument decodes a single YAML front matter document
+func decodeYAMLDocument(document []byte, options ...interface{}) (map[string]interface{}, error) {
+	if hasFrontMatterOption(ExplicitYAMLTags, options...) {
+		return decodeTaggedYAML(document)
+	}
+	items := make(map[string]interface{})
+	err := yaml.Unmarshal(document, &items)
+	return items, err
+}
+
+// nextYAMLDocument returns the YAML mapping at the start of b which is closed by the fence, along with the number of
+// bytes it spans including the fence line; false if there's no closing fence or the content isn't a mapping
+func nextYAMLDocument(b []byte, closingFence string, options ...interface{}) ([]byte, map[string]interface{}, int, bool) {
+	for offset := 0; offset < len(b); {
+		lineEnd := len(b)
+		if newline := bytes.IndexByte(b[offset:], '\n'); newline >= 0 {
+			lineEnd = offset + newline + 1
+		}
+		if !isFrontMatterFence(string(b[offset:lineEnd]), closingFence) {
+			offset = lineEnd
+			continue
+		}
+
+		document := normalizeLineEndings(b[:offset])
+		items, err := decodeYAMLDocument(document, options...)
+		if err != nil || len(items) == 0 {
+			return nil, nil, 0, false
+		}
+		return document, items, lineEnd, true
+	}
+	return nil, nil, 0, false
+}
+
+// decodeYAMLFrontMatter splits an input byte array like ---<stuff>---\n<body> into <stuff> decoded as YAML and <body>;
+// if the YAML is invalid the salvaged lines are returned along with an ErrDegradedFrontMatter error
+func decodeYAMLFrontMatter(b []byte, dest interface{}, options ...interface{}) ([]byte, map[string]interface{}, KeyOrderTree, error) {
+	openingFence, closingFence := "---", "---"
+	if hasFrontMatterOption(HTMLCommentFences, options...) {
+		openingFence, closingFence = "<!--", "-->"
+	}
+
+	region, found, err := locateFrontMatter(b, openingFence, closingFence, options...)
+	if err != nil {
+		return nil, nil, KeyOrderTree{}, err
+	}
+	if !found {
+		return b, nil, KeyOrderTree{}, nil
+	}
+	yamlStartIndex, yamlEndIndex, bodyStartIndex := region.start, region.end, region.bodyStart
+	frontMatter := normalizeLineEndings(b[yamlStartIndex:yamlEndIndex])
+
+	items, err := decodeYAMLDocument(frontMatter, options...)
 	if err != nil {
-		return nil, nil, 0, nil
+		err = fmt.Errorf("unable to decode front matter at bytes %d-%d: %w", yamlStartIndex, yamlEndIndex, err)
+
+		// keep partially-valid front matter usable by salvaging simple key: value lines as text
+		salvaged := salvageFrontMatterLines(frontMatter)
+		if len(salvaged) == 0 {
+			return nil, nil, KeyOrderTree{}, err
+		}
+		return bytes.TrimSpace(b[bodyStartIndex:]), salvaged, KeyOrderTree{}, fmt.Errorf("%w: %v", ErrDegradedFrontMatter, err)
+	}
+
+	documents := [][]byte{frontMatter}
+	decoded := []map[string]interface{}{items}
+	if hasFrontMatterOption(MergeYAMLDocuments, options...) {
+		for {
+			document, next, length, ok := nextYAMLDocument(b[bodyStartIndex:], closingFence, options...)
+			if !ok {
+				break
+			}
+			documents = append(documents, document)
+			decoded = append(decoded, next)
+			bodyStartIndex += length
+		}
+	}
+
+	merged := make(map[string]interface{}, len(items))
+	var order KeyOrderTree
+	ordered := make(map[string]bool, len(items))
+	for i, document := range documents {
+		if dest != nil {
+			if err = yaml.Unmarshal(document, dest); err != nil {
+				return nil, nil, KeyOrderTree{}, fmt.Errorf("unable to decode front matter into %T: %w", dest, err)
+			}
+		}
+		if hasFrontMatterOption(PreserveNumericText, options...) {
+			if err = preserveNumericText(document, decoded[i]); err != nil {
+				return nil, nil, KeyOrderTree{}, err
+			}
+		}
+		for name, value := range decoded[i] {
+			merged[name] = value
+		}
+		// later documents replace whole values, so a nested map's order comes from the document which wins
+		documentOrder := yamlKeyOrder(document)
+		for _, name := range documentOrder.Keys {
+			if !ordered[name] {
+				ordered[name] = true
+				order.Keys = append(order.Keys, name)
+			}
+			if nested, ok := documentOrder.Nested[name]; ok {
+				if order.Nested == nil {
+					order.Nested = make(map[string]KeyOrderTree)
+				}
+				order.Nested[name] = nested
+			} else {
+				delete(order.Nested, name)
+			}
+		}
 	}
-	props, count, err = f.fromStringMap(ctx, items, allow, options...)
 
-	return bytes.TrimSpace(b[yamlEndIndex:]), props, count, err
+	return bytes.TrimSpace(b[bodyStartIndex:]), merged, order, nil
+}
+
+// salvageFrontMatterLines extracts top-level "key: value" lines as text, skipping anything it can't understand
+func salvageFrontMatterLines(b []byte) map[string]interface{} {
+	items := make(map[string]interface{})
+	for _, line := range strings.Split(string(b), "\n") {
+		if line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '#' {
+			continue
+		}
+		separator := strings.Index(line, ": ")
+		if separator <= 0 {
+			continue
+		}
+		name := strings.TrimSpace(line[:separator])
+		value := strings.Trim(strings.TrimSpace(line[separator+2:]), `"'`)
+		if name == "" || value == "" {
+			continue
+		}
+		items[name] = value
+	}
+	return items
+}
+
+// isFrontMatterFence returns true if the line is the given fence, optionally followed by whitespace and a comment
+// (e.g. "--- # front matter")
+func isFrontMatterFence(line string, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, fence) {
+		return false
+	}
+	rest := trimmed[len(fence):]
+	if rest == "" {
+		return true
+	}
+	comment := strings.TrimLeft(rest, " \t")
+	return len(comment) < len(rest) && strings.HasPrefix(comment, "#")
+}
+
+// findGluedFence looks for a line after start which ends with the fence glued onto other content (e.g.
+// "key: value---") and returns its 1-based line number within b
+func findGluedFence(b []byte, start int, fence string) (int, string, bool) {
+	number := bytes.Count(b[:start], []byte("\n"))
+	for _, line := range strings.Split(string(b[start:]), "\n") {
+		number++
+		trimmed := strings.TrimSpace(line)
+		if trimmed != fence && strings.HasSuffix(trimmed, fence) {
+			return number, trimmed, true
+		}
+	}
+	return 0, "", false
 }
@@ -0,0 +1,127 @@
+package properties
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FormatterFunc renders a property value as text for serialization
+type FormatterFunc func(context.Context, Property) (string, error)
+
+// FormatterRegistry holds the FormatterFunc used for each PropertyKind by the export helpers (WriteFrontMatter and
+// WriteCSV); pass a registry in their options or register overrides on DefaultFormatters to apply them everywhere
+type FormatterRegistry struct {
+	mu         sync.RWMutex
+	formatters map[PropertyKind]FormatterFunc
+}
+
+// DefaultFormatters is the registry the export helpers use when none is passed in options
+var DefaultFormatters = NewFormatterRegistry()
+
+// NewFormatterRegistry returns a registry with the default formatters (e.g. RFC3339 dates, comma-separated lists)
+func NewFormatterRegistry() *FormatterRegistry {
+	return &FormatterRegistry{formatters: map[PropertyKind]FormatterFunc{
+		KindText: func(ctx context.Context, p Property) (string, error) {
+			return p.(TextProperty).Value(ctx), nil
+		},
+		KindTextList: func(ctx context.Context, p Property) (string, error) {
+			return strings.Join(p.(TextListProperty).Value(ctx), ","), nil
+		},
+		KindFlag: func(ctx context.Context, p Property) (string, error) {
+			return strconv.FormatBool(p.(FlagProperty).Value(ctx)), nil
+		},
+		KindDateTime: func(ctx context.Context, p Property) (string, error) {
+			return p.(DateTimeProperty).Value(ctx).Format(time.RFC3339), nil
+		},
+		KindCardinal: func(ctx context.Context, p Property) (string, error) {
+			return strconv.FormatInt(p.(CardinalProperty).Value(ctx), 10), nil
+		},
+		KindCardinalList: func(ctx context.Context, p Property) (string, error) {
+			values := p.(CardinalListProperty).Value(ctx)
+			texts := make([]string, len(values))
+			for i, value := range values {
+				texts[i] = strconv.FormatInt(value, 10)
+			}
+			return strings.Join(texts, ","), nil
+		},
+		KindFloatList: func(ctx context.Context, p Property) (string, error) {
+			values := p.(FloatListProperty).Value(ctx)
+			texts := make([]string, len(values))
+			for i, value := range values {
+				texts[i] = strconv.FormatFloat(value, 'g', -1, 64)
+			}
+			return strings.Join(texts, ","), nil
+		},
+		KindNumericText: func(ctx context.Context, p Property) (string, error) {
+			return string(p.(NumericTextProperty).Value(ctx)), nil
+		},
+		KindMap: func(ctx context.Context, p Property) (string, error) {
+			b, err := json.Marshal(p.JSONValue(ctx))
+			return string(b), err
+		},
+		KindDuration: func(ctx context.Context, p Property) (string, error) {
+			return p.(DurationProperty).Value(ctx).String(), nil
+		},
+		KindURL: func(ctx context.Context, p Property) (string, error) {
+			if link := p.(URLProperty).Value(ctx); link != nil {
+				return link.String(), nil
+			}
+			return "", nil
+		},
+		KindBigInt: func(ctx context.Context, p Property) (string, error) {
+			return p.(BigIntProperty).Value(ctx).String(), nil
+		},
+	}}
+}
+
+// Register replaces the formatter for the kind
+func (r *FormatterRegistry) Register(kind PropertyKind, fn FormatterFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.formatters[kind] = fn
+}
+
+// Format renders the property with the formatter registered for its kind, unknown kinds use fmt's %v
+func (r *FormatterRegistry) Format(ctx context.Context, p Property) (string, error) {
+	p = unwrap(p)
+	r.mu.RLock()
+	fn, ok := r.formatters[KindOf(ctx, p)]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Sprintf("%v", p.AnyValue(ctx)), nil
+	}
+	return fn(ctx, p)
+}
+
+func formattersFor(options ...interface{}) *FormatterRegistry {
+	for _, option := range options {
+		if instance, ok := option.(*FormatterRegistry); ok {
+			return instance
+		}
+	}
+	return DefaultFormatters
+}
+
+// WriteCSV emits a "name,value" row for each property, rendering values with the formatter registry
+func WriteCSV(ctx context.Context, w io.Writer, props Properties, options ...interface{}) error {
+	formatters := formattersFor(options...)
+	writer := csv.NewWriter(w)
+	for _, property := range props.List(ctx, options...) {
+		value, err := formatters.Format(ctx, property)
+		if err != nil {
+			return fmt.Errorf("unable to write %q property: %w", property.Name(ctx), err)
+		}
+		if err := writer.Write([]string{string(property.Name(ctx)), value}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
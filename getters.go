@@ -0,0 +1,158 @@
+package properties
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// unwrap strips wrappers such as DefaultOriginProperty so that the typed property interface can be asserted
+func unwrap(prop Property) Property {
+	for {
+		wrapper, ok := prop.(interface{ Unwrap() Property })
+		if !ok {
+			return prop
+		}
+		prop = wrapper.Unwrap()
+	}
+}
+
+// named returns the unwrapped named property
+func named(ctx context.Context, props Properties, name PropertyName) (Property, bool) {
+	prop, ok := props.Named(ctx, name)
+	if !ok {
+		return nil, false
+	}
+	return unwrap(prop), true
+}
+
+// GetString returns the value of the named TextProperty, false if it's missing or of another type
+func GetString(ctx context.Context, props Properties, name PropertyName) (string, bool) {
+	if prop, ok := named(ctx, props, name); ok {
+		if text, ok := prop.(TextProperty); ok {
+			return text.Value(ctx), true
+		}
+	}
+	return "", false
+}
+
+// GetInt returns the value of the named CardinalProperty, false if it's missing or of another type
+func GetInt(ctx context.Context, props Properties, name PropertyName) (int64, bool) {
+	if prop, ok := named(ctx, props, name); ok {
+		if cardinal, ok := prop.(CardinalProperty); ok {
+			return cardinal.Value(ctx), true
+		}
+	}
+	return 0, false
+}
+
+// GetBool returns the value of the named FlagProperty, false if it's missing or of another type
+func GetBool(ctx context.Context, props Properties, name PropertyName) (bool, bool) {
+	if prop, ok := named(ctx, props, name); ok {
+		if flag, ok := prop.(FlagProperty); ok {
+			return flag.Value(ctx), true
+		}
+	}
+	return false, false
+}
+
+// GetTime returns the value of the named DateTimeProperty, false if it's missing or of another type
+func GetTime(ctx context.Context, props Properties, name PropertyName) (time.Time, bool) {
+	if prop, ok := named(ctx, props, name); ok {
+		if dateTime, ok := prop.(DateTimeProperty); ok {
+			return dateTime.Value(ctx), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// GetStringList returns the value of the named TextListProperty, false if it's missing or of another type
+func GetStringList(ctx context.Context, props Properties, name PropertyName) ([]string, bool) {
+	if prop, ok := named(ctx, props, name); ok {
+		if list, ok := prop.(TextListProperty); ok {
+			return list.Value(ctx), true
+		}
+	}
+	return nil, false
+}
+
+// GetInt64List returns the value of the named CardinalListProperty, false if it's missing or of another type
+func GetInt64List(ctx context.Context, props Properties, name PropertyName) ([]int64, bool) {
+	if prop, ok := named(ctx, props, name); ok {
+		if list, ok := prop.(CardinalListProperty); ok {
+			return list.Value(ctx), true
+		}
+	}
+	return nil, false
+}
+
+// GetFloat64List returns the value of the named FloatListProperty, false if it's missing or of another type
+func GetFloat64List(ctx context.Context, props Properties, name PropertyName) ([]float64, bool) {
+	if prop, ok := named(ctx, props, name); ok {
+		if list, ok := prop.(FloatListProperty); ok {
+			return list.Value(ctx), true
+		}
+	}
+	return nil, false
+}
+
+// mustGet panics with the property name and the expected vs actual kind when the getter didn't find a value
+func mustGet(ctx context.Context, props Properties, name PropertyName, expected PropertyKind, found bool) {
+	if found {
+		return
+	}
+	prop, ok := named(ctx, props, name)
+	if !ok {
+		panic(fmt.Sprintf("required property %q is missing, expected %s", name, expected))
+	}
+	panic(fmt.Sprintf("required property %q is %s (%T), expected %s", name, KindOf(ctx, prop), prop, expected))
+}
+
+// MustGetString is GetString for mandatory properties, it panics if the property is missing or of another type
+func MustGetString(ctx context.Context, props Properties, name PropertyName) string {
+	value, ok := GetString(ctx, props, name)
+	mustGet(ctx, props, name, KindText, ok)
+	return value
+}
+
+// MustGetInt is GetInt for mandatory properties, it panics if the property is missing or of another type
+func MustGetInt(ctx context.Context, props Properties, name PropertyName) int64 {
+	value, ok := GetInt(ctx, props, name)
+	mustGet(ctx, props, name, KindCardinal, ok)
+	return value
+}
+
+// MustGetBool is GetBool for mandatory properties, it panics if the property is missing or of another type
+func MustGetBool(ctx context.Context, props Properties, name PropertyName) bool {
+	value, ok := GetBool(ctx, props, name)
+	mustGet(ctx, props, name, KindFlag, ok)
+	return value
+}
+
+// MustGetTime is GetTime for mandatory properties, it panics if the property is missing or of another type
+func MustGetTime(ctx context.Context, props Properties, name PropertyName) time.Time {
+	value, ok := GetTime(ctx, props, name)
+	mustGet(ctx, props, name, KindDateTime, ok)
+	return value
+}
+
+// MustGetStringList is GetStringList for mandatory properties, it panics if the property is missing or of another type
+func MustGetStringList(ctx context.Context, props Properties, name PropertyName) []string {
+	value, ok := GetStringList(ctx, props, name)
+	mustGet(ctx, props, name, KindTextList, ok)
+	return value
+}
+
+// MustGetInt64List is GetInt64List for mandatory properties, it panics if the property is missing or of another type
+func MustGetInt64List(ctx context.Context, props Properties, name PropertyName) []int64 {
+	value, ok := GetInt64List(ctx, props, name)
+	mustGet(ctx, props, name, KindCardinalList, ok)
+	return value
+}
+
+// MustGetFloat64List is GetFloat64List for mandatory properties, it panics if the property is missing or of another type
+func MustGetFloat64List(ctx context.Context, props Properties, name PropertyName) []float64 {
+	value, ok := GetFloat64List(ctx, props, name)
+	mustGet(ctx, props, name, KindFloatList, ok)
+	return value
+}
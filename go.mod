@@ -1,12 +1,18 @@
 module github.com/lectio/properties
 
-go 1.12
+go 1.18
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/araddon/dateparse v0.0.0-20190510211750-d2ba70357e92
+	github.com/stretchr/testify v1.3.0
+	gopkg.in/yaml.v2 v2.2.2
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/kr/pretty v0.1.0 // indirect
-	github.com/stretchr/testify v1.3.0
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
-	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,121 @@
+package properties
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Interner may be passed in EmptyMutable options so that repeated text values share storage; every string returned
+// by Intern is given back through Release when the collection stops referencing it
+type Interner interface {
+	Intern(string) string
+	Release(string)
+}
+
+// RefCountingInterner is an Interner which counts references to each interned string and drops strings which are
+// no longer referenced, so the pool doesn't grow unbounded in long-running processes
+type RefCountingInterner struct {
+	mu   sync.Mutex
+	refs map[string]int
+	pool map[string]string
+}
+
+// NewRefCountingInterner returns an empty RefCountingInterner
+func NewRefCountingInterner() *RefCountingInterner {
+	return &RefCountingInterner{refs: make(map[string]int), pool: make(map[string]string)}
+}
+
+// Intern returns the shared copy of value, adding a reference to it
+func (i *RefCountingInterner) Intern(value string) string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	shared, ok := i.pool[value]
+	if !ok {
+		shared = value
+		i.pool[value] = shared
+	}
+	i.refs[value]++
+	return shared
+}
+
+// Release removes a reference to value, dropping it from the pool once nothing references it
+func (i *RefCountingInterner) Release(value string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	refs, ok := i.refs[value]
+	if !ok {
+		return
+	}
+	if refs <= 1 {
+		delete(i.refs, value)
+		delete(i.pool, value)
+		return
+	}
+	i.refs[value] = refs - 1
+}
+
+// Len returns the number of distinct strings in the pool
+func (i *RefCountingInterner) Len() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return len(i.pool)
+}
+
+// intern returns a copy of text and text list properties whose values come from the collection's interner; the
+// collection records the values it interned for each copy, so it gives back exactly those even if the property's
+// value is later assigned in place
+func (p *Default) intern(ctx context.Context, prop Property) Property {
+	if p.interner == nil {
+		return prop
+	}
+	switch value := prop.(type) {
+	case *DefaultTextProperty:
+		interned := &DefaultTextProperty{value.PropName, p.interner.Intern(value.Text)}
+		p.interned.Store(interned, []string{interned.Text})
+		return interned
+	case *DefaultTextListProperty:
+		interned := &DefaultTextListProperty{value.PropName, internAll(p.interner, value.Slice)}
+		p.interned.Store(interned, append([]string(nil), interned.Slice...))
+		return interned
+	default:
+		return prop
+	}
+}
+
+// internAll returns a copy of values taken from the interner
+func internAll(interner Interner, values []string) []string {
+	interned := make([]string, len(values))
+	for i, text := range values {
+		interned[i] = interner.Intern(text)
+	}
+	return interned
+}
+
+// release gives back the values interned for a property which is no longer stored
+func (p *Default) release(ctx context.Context, prop Property) {
+	if p.interner == nil {
+		return
+	}
+	if values, ok := p.interned.LoadAndDelete(prop); ok {
+		for _, text := range values.([]string) {
+			p.interner.Release(text)
+		}
+	}
+}
+
+// Release empties the collection at the end of its lifecycle, giving back every interned value to the interner;
+// no change events are fired
+func (p *Default) Release(ctx context.Context) {
+	p.orderMu.Lock()
+	names := p.order
+	p.order = nil
+	for _, name := range names {
+		if prop, ok := p.syncMap.LoadAndDelete(name); ok {
+			p.listIndexes.Delete(name)
+			atomic.AddInt64(&p.syncMapSize, -1)
+			p.release(ctx, prop.(Property))
+		}
+	}
+	p.orderMu.Unlock()
+}
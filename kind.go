@@ -0,0 +1,186 @@
+package properties
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// PropertyKind classifies properties by the type of their value
+type PropertyKind int
+
+const (
+	// KindUnknown is any property which doesn't implement one of the typed property interfaces
+	KindUnknown PropertyKind = iota
+	KindText
+	KindTextList
+	KindFlag
+	KindDateTime
+	KindCardinal
+	KindCardinalList
+	KindFloatList
+	KindNumericText
+	KindMap
+	KindDuration
+	KindURL
+	KindBigInt
+)
+
+var kindNames = map[PropertyKind]string{
+	KindUnknown:      "unknown",
+	KindText:         "text",
+	KindTextList:     "text list",
+	KindFlag:         "flag",
+	KindDateTime:     "date time",
+	KindCardinal:     "cardinal",
+	KindCardinalList: "cardinal list",
+	KindFloatList:    "float list",
+	KindNumericText:  "numeric text",
+	KindMap:          "map",
+	KindDuration:     "duration",
+	KindURL:          "URL",
+	KindBigInt:       "big integer",
+}
+
+func (k PropertyKind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("PropertyKind(%d)", int(k))
+}
+
+// KindedProperty may be implemented by custom properties to report their own kind to KindOf
+type KindedProperty interface {
+	Property
+	Kind(context.Context) PropertyKind
+}
+
+// KindOf returns the kind of the property based on the typed property interface it implements, seeing through
+// wrappers such as DefaultOriginProperty; custom properties may classify themselves by implementing KindedProperty
+func KindOf(ctx context.Context, p Property) PropertyKind {
+	p = unwrap(p)
+	if kinded, ok := p.(KindedProperty); ok {
+		return kinded.Kind(ctx)
+	}
+	switch p.(type) {
+	case TextProperty:
+		return KindText
+	case TextListProperty:
+		return KindTextList
+	case FlagProperty:
+		return KindFlag
+	case DateTimeProperty:
+		return KindDateTime
+	case CardinalProperty:
+		return KindCardinal
+	case CardinalListProperty:
+		return KindCardinalList
+	case FloatListProperty:
+		return KindFloatList
+	case NumericTextProperty:
+		return KindNumericText
+	case MapProperty:
+		return KindMap
+	case DurationProperty:
+		return KindDuration
+	case URLProperty:
+		return KindURL
+	case BigIntProperty:
+		return KindBigInt
+	default:
+		return KindUnknown
+	}
+}
+
+// Convert re-interprets the property as the target kind by parsing its value strictly as that kind and running
+// the result through the factory, e.g. text holding "123" into a cardinal; it returns an error if the value can't
+// be expressed as the target kind
+func Convert(ctx context.Context, prop Property, target PropertyKind, factory PropertyFactory) (Property, error) {
+	if KindOf(ctx, prop) == target {
+		return prop, nil
+	}
+
+	name := string(prop.Name(ctx))
+	text, ok := prop.AnyValue(ctx).(string)
+	if !ok {
+		text = fmt.Sprintf("%v", prop.AnyValue(ctx))
+	}
+
+	value, ok := parseAs(text, target)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert %q property from %s to %s: %q", name, KindOf(ctx, prop), target, text)
+	}
+	converted, _, err := factory.FromAny(ctx, name, value)
+	if err != nil {
+		return nil, err
+	}
+	if converted == nil || KindOf(ctx, converted) != target {
+		return nil, fmt.Errorf("unable to convert %q property from %s to %s: %q", name, KindOf(ctx, prop), target, text)
+	}
+	return converted, nil
+}
+
+// parseAs parses text as the value type of the target kind only, so that e.g. "1" becomes a cardinal rather than
+// the flag the smart parser would make of it
+func parseAs(text string, target PropertyKind) (interface{}, bool) {
+	switch target {
+	case KindText:
+		return text, true
+	case KindTextList:
+		return []string{text}, true
+	case KindFlag:
+		flag, err := strconv.ParseBool(text)
+		return flag, err == nil
+	case KindDateTime:
+		return parseDate(text)
+	case KindCardinal:
+		number, err := strconv.ParseInt(text, 10, 64)
+		return number, err == nil
+	case KindCardinalList:
+		number, err := strconv.ParseInt(text, 10, 64)
+		return []int64{number}, err == nil
+	case KindFloatList:
+		number, err := strconv.ParseFloat(text, 64)
+		return []float64{number}, err == nil
+	case KindNumericText:
+		_, err := strconv.ParseFloat(text, 64)
+		return NumericText(text), err == nil
+	case KindDuration:
+		duration, err := time.ParseDuration(text)
+		return duration, err == nil
+	case KindURL:
+		link, err := url.Parse(text)
+		return link, err == nil && link.Scheme != "" && link.Host != ""
+	case KindBigInt:
+		return new(big.Int).SetString(text, 10)
+	default:
+		return nil, false
+	}
+}
+
+// CheckKinds verifies that each expected property is present and of the expected kind, returning one error per
+// missing or mismatched name (sorted by name) so that every problem is reported at once
+func CheckKinds(ctx context.Context, props Properties, expected map[PropertyName]PropertyKind) []error {
+	names := make([]PropertyName, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+
+	var errs []error
+	for _, name := range names {
+		prop, ok := named(ctx, props, name)
+		if !ok {
+			errs = append(errs, fmt.Errorf("property %q is missing, expected %s", name, expected[name]))
+			continue
+		}
+		if kind := KindOf(ctx, prop); kind != expected[name] {
+			errs = append(errs, fmt.Errorf("property %q is %s, expected %s", name, kind, expected[name]))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,58 @@
+package properties
+
+import (
+	"context"
+	"time"
+)
+
+// Clock provides the current time wherever properties need it (e.g. relative dates and expiry), it may be
+// passed in options or attached to a context
+type Clock interface {
+	Now() time.Time
+}
+
+// NowFunc returns the current time
+type NowFunc func() time.Time
+
+// Now implements Clock
+func (f NowFunc) Now() time.Time {
+	return f()
+}
+
+// FixedClock is a Clock which always returns the same time, useful for reproducible tests
+type FixedClock time.Time
+
+// Now implements Clock
+func (c FixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+type clockContextKey struct{}
+
+// ContextWithClock returns a context whose notion of the current time is given by clock
+func ContextWithClock(ctx context.Context, clock Clock) context.Context {
+	return context.WithValue(ctx, clockContextKey{}, clock)
+}
+
+// ContextWithNow returns a context whose notion of the current time is given by now, useful for tests
+func ContextWithNow(ctx context.Context, now NowFunc) context.Context {
+	return ContextWithClock(ctx, now)
+}
+
+// Now returns the current time according to the context, falling back to time.Now
+func Now(ctx context.Context) time.Time {
+	if clock, ok := ctx.Value(clockContextKey{}).(Clock); ok && clock != nil {
+		return clock.Now()
+	}
+	return time.Now()
+}
+
+// nowFor returns the current time according to a Clock passed in options, falling back to Now(ctx)
+func nowFor(ctx context.Context, options ...interface{}) time.Time {
+	for _, option := range options {
+		if clock, ok := option.(Clock); ok {
+			return clock.Now()
+		}
+	}
+	return Now(ctx)
+}
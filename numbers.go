@@ -0,0 +1,84 @@
+package properties
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// NumberParser may be set on DefaultPropertyFactory or passed in FromText options to plug locale-aware number
+// parsing into the smart parser; ParseNumber returns an int64 or a NumericText and true if the text is a number
+type NumberParser interface {
+	ParseNumber(ctx context.Context, value string) (interface{}, bool)
+}
+
+// NumberParserFunc adapts a function into a NumberParser
+type NumberParserFunc func(ctx context.Context, value string) (interface{}, bool)
+
+// ParseNumber calls fn
+func (fn NumberParserFunc) ParseNumber(ctx context.Context, value string) (interface{}, bool) {
+	return fn(ctx, value)
+}
+
+// SeparatorNumberParser parses numbers written with the given thousands and decimal separators, e.g. "1.234,56"
+// with Thousands "." and Decimal ","; integers become int64 and decimals become NumericText in Go syntax
+type SeparatorNumberParser struct {
+	Thousands string
+	Decimal   string
+}
+
+// ParseNumber returns the int64 or NumericText value of the text, false if it isn't a number with valid grouping
+func (p SeparatorNumberParser) ParseNumber(ctx context.Context, value string) (interface{}, bool) {
+	integer, fraction, hasFraction := value, "", false
+	if p.Decimal != "" {
+		if index := strings.LastIndex(value, p.Decimal); index >= 0 {
+			integer, fraction, hasFraction = value[:index], value[index+len(p.Decimal):], true
+		}
+	}
+
+	digits, ok := p.ungroup(integer)
+	if !ok {
+		return nil, false
+	}
+	if !hasFraction {
+		number, err := strconv.ParseInt(digits, 10, 64)
+		return number, err == nil
+	}
+
+	text := digits + "." + fraction
+	if _, err := strconv.ParseFloat(text, 64); err != nil || fraction == "" || strings.ContainsAny(fraction, "+-eE") {
+		return nil, false
+	}
+	return NumericText(text), true
+}
+
+// ungroup removes the thousands separators, which must split the digits into groups of three after the first group
+func (p SeparatorNumberParser) ungroup(integer string) (string, bool) {
+	if p.Thousands == "" || !strings.Contains(integer, p.Thousands) {
+		return integer, true
+	}
+	sign := ""
+	if strings.HasPrefix(integer, "-") {
+		sign, integer = "-", integer[1:]
+	}
+	groups := strings.Split(integer, p.Thousands)
+	if len(groups[0]) == 0 || len(groups[0]) > 3 {
+		return "", false
+	}
+	for _, group := range groups[1:] {
+		if len(group) != 3 {
+			return "", false
+		}
+	}
+	return sign + strings.Join(groups, ""), true
+}
+
+// numberParser returns the NumberParser passed in options or configured on the factory, nil if there's none
+func (f *DefaultPropertyFactory) numberParser(options ...interface{}) NumberParser {
+	for _, option := range options {
+		if instance, ok := option.(NumberParser); ok {
+			return instance
+		}
+	}
+	return f.NumberParser
+}
@@ -2,10 +2,21 @@ package properties
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ErrEmptyPropertyName is returned when adding a property whose name is empty
+var ErrEmptyPropertyName = errors.New("property name is empty")
+
+// ErrStopRange may be returned by a RangeMutable callback to stop iterating without reporting an error
+var ErrStopRange = errors.New("stop range")
+
 // AddPropertyPolicy can prevent a property from being added
 type AddPropertyPolicy interface {
 	AllowAdd(context.Context, Property, ...interface{}) (Property, bool, error)
@@ -16,17 +27,53 @@ type AddPropertyEvent interface {
 	PropertyAdded(context.Context, Property, ...interface{})
 }
 
-// MapAssignFunc is passed into Properties.Map() to assign values into a string map
-type MapAssignFunc func(context.Context, Property, map[string]interface{}, ...interface{}) bool
+// UpdatePropertyEvent announces when adding a property replaced the stored property of the same name; an
+// AddPropertyEvent observer which doesn't implement it is notified of replacements through PropertyAdded instead
+type UpdatePropertyEvent interface {
+	PropertyUpdated(ctx context.Context, old Property, new Property, options ...interface{})
+}
+
+// DeletePropertyEvent announces when a property has been deleted, passing the property which was stored
+type DeletePropertyEvent interface {
+	PropertyDeleted(context.Context, Property, ...interface{})
+}
+
+// MapAssignFunc is passed into Properties.Map() to assign values into a string map; it returns whether the property
+// should be counted (e.g. it was assigned) and, separately, whether the iteration should keep going
+type MapAssignFunc func(context.Context, Property, map[string]interface{}, ...interface{}) (counted bool, keepGoing bool)
+
+// KeyValue is a name and value pair returned by Properties.MapOrdered()
+type KeyValue struct {
+	Name  string
+	Value interface{}
+}
+
+// FilterWhileFunc is passed into Properties.FilterWhile(); it returns whether the property should be included and,
+// separately, whether the iteration should keep going
+type FilterWhileFunc func(context.Context, Property) (include bool, keepGoing bool)
 
 // Properties manages a group of strongly typed properties, immutable
 type Properties interface {
 	List(context.Context, ...interface{}) []Property
+	Keys(context.Context) []PropertyName
+	Values(context.Context) []interface{}
+	Into(context.Context, []Property, ...interface{}) []Property
 	Map(context.Context, map[string]interface{}, MapAssignFunc, ...interface{}) uint
+	MapSafe(context.Context, MapAssignFunc, ...interface{}) (map[string]interface{}, uint)
+	MapOrdered(context.Context, ...interface{}) []KeyValue
 	Named(context.Context, PropertyName) (Property, bool)
+	Has(context.Context, PropertyName) bool
 	Filter(context.Context, func(context.Context, Property) bool, ...interface{}) []Property
+	FilterWhile(context.Context, FilterWhileFunc, ...interface{}) []Property
+	FilterMap(context.Context, func(context.Context, Property) (interface{}, bool), ...interface{}) []interface{}
+	FilterByType(context.Context, PropertyKind, ...interface{}) []Property
 	Range(context.Context, func(context.Context, Property) bool, ...interface{})
 	Size(context.Context) uint
+	CountBy(context.Context, func(context.Context, Property) string, ...interface{}) map[string]uint
+	EqualIgnoring(context.Context, Properties, ...PropertyName) bool
+	HasListValue(context.Context, PropertyName, string, ...interface{}) bool
+	ChangedSince(context.Context, Properties) []Property
+	RemovedSince(context.Context, Properties) []PropertyName
 }
 
 // AllowAddFunc returns true if the property should be added
@@ -40,22 +87,192 @@ type MutableProperties interface {
 	Properties
 	AddMap(context.Context, map[string]interface{}, AllowAddFunc, ...interface{}) (uint, error)
 	AddTextMap(context.Context, map[string]string, AllowAddTextFunc, ...interface{}) (uint, error)
+	AddAnyChecked(context.Context, string, interface{}, AllowAddFunc, ...interface{}) (Property, bool, error)
 	AddChecked(context.Context, string, interface{}, AllowAddFunc, ...interface{}) (Property, bool, error)
 	AddParsedChecked(context.Context, string, string, AllowAddTextFunc, ...interface{}) (Property, bool, error)
+	AddAny(context.Context, string, interface{}, ...interface{}) (Property, bool, error)
 	Add(context.Context, string, interface{}, ...interface{}) (Property, bool, error)
 	AddParsed(context.Context, string, string, ...interface{}) (Property, bool, error)
 	AddProperty(context.Context, Property, ...interface{}) (Property, bool, error)
+	AddProperties(context.Context, []Property, ...interface{}) (uint, error)
 	Delete(context.Context, PropertyName, ...interface{}) (bool, error)
+	Clear(context.Context, ...interface{}) uint
+	Recount(context.Context) uint
 	DeleteProperty(context.Context, Property, ...interface{}) (bool, error)
+	BatchEvents(context.Context) func()
+	Merge(context.Context, Properties, MergeConflictFunc, ...interface{}) (uint, error)
+	RangeMutable(context.Context, func(context.Context, Property) (bool, error), ...interface{}) (uint, error)
+	Clone(context.Context) MutableProperties
+}
+
+// MergeConflictFunc resolves a name present in both collections during Merge; it returns the winning property and
+// whether the name should be kept at all
+type MergeConflictFunc func(ctx context.Context, existing Property, incoming Property) (winner Property, keep bool)
+
+// OverwriteConflicts is a MergeConflictFunc which replaces existing properties with incoming ones (same as nil)
+func OverwriteConflicts(ctx context.Context, existing Property, incoming Property) (Property, bool) {
+	return incoming, true
 }
 
-// Default is the default properties implementation (supports mutability)
+// SkipConflicts is a MergeConflictFunc which keeps existing properties, so only new names are merged (e.g. page
+// front matter merged over site defaults with the page winning)
+func SkipConflicts(ctx context.Context, existing Property, incoming Property) (Property, bool) {
+	return existing, true
+}
+
+// AddMapOption may be passed in options to AddMap and AddTextMap to control how the items are visited
+type AddMapOption int
+
+const (
+	// FirstSortedKeyWins visits items sorted by their original key and keeps the first property created for each
+	// name, so that distinct keys which collapse into the same name (e.g. through hooks) resolve deterministically
+	FirstSortedKeyWins AddMapOption = iota + 1
+)
+
+// KeyOrder may be passed in AddMap and AddTextMap options to add the items in the given key order (e.g. the order
+// they were declared in front matter), items whose keys aren't listed are added afterwards sorted by key
+type KeyOrder []string
+
+// KeyOrderTree holds the declaration order of a map's keys and, by key, of the maps nested in it; passed in AddMap
+// options it orders the items like KeyOrder and gives each nested map (see NestedProperty) its own order
+type KeyOrderTree struct {
+	Keys   KeyOrder
+	Nested map[string]KeyOrderTree
+}
+
+// add appends the last element of a key path (e.g. a TOML key) to the order of the map the path leads to
+func (t *KeyOrderTree) add(path []string) {
+	switch len(path) {
+	case 0:
+	case 1:
+		t.Keys = append(t.Keys, path[0])
+	default:
+		if t.Nested == nil {
+			t.Nested = make(map[string]KeyOrderTree)
+		}
+		nested := t.Nested[path[0]]
+		nested.add(path[1:])
+		t.Nested[path[0]] = nested
+	}
+}
+
+// orderedKeys returns the keys of items following any KeyOrder (or KeyOrderTree) option, then sorted
+func orderedKeys(keys []string, options ...interface{}) []string {
+	var order KeyOrder
+	for _, option := range options {
+		switch instance := option.(type) {
+		case KeyOrder:
+			order = instance
+		case KeyOrderTree:
+			order = instance.Keys
+		}
+	}
+
+	present := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		present[key] = true
+	}
+	result := make([]string, 0, len(keys))
+	for _, key := range order {
+		if present[key] {
+			result = append(result, key)
+			delete(present, key)
+		}
+	}
+	rest := make([]string, 0, len(present))
+	for key := range present {
+		rest = append(rest, key)
+	}
+	sort.Strings(rest)
+	return append(result, rest...)
+}
+
+func hasAddMapOption(option AddMapOption, options ...interface{}) bool {
+	for _, o := range options {
+		if instance, ok := o.(AddMapOption); ok && instance == option {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpiryPolicy may be passed in options when creating a collection to make it aware of ExpiringProperty instances
+type ExpiryPolicy int
+
+const (
+	// SkipExpired hides expired properties from Named, List and the other readers but keeps them stored
+	SkipExpired ExpiryPolicy = iota + 1
+
+	// EvictExpired hides expired properties and deletes them from the collection when they're found
+	EvictExpired
+)
+
+// AliasGroup may be passed in AddMap options so that several source keys populate one canonical property; the
+// first of the Aliases (in order) which has a non-empty value wins and the other aliases are dropped
+type AliasGroup struct {
+	Canonical PropertyName
+	Aliases   []string
+}
+
+// applyAliasGroups returns a copy of items with the alias groups in options resolved, or items itself if there are none
+func applyAliasGroups(items map[string]interface{}, options ...interface{}) map[string]interface{} {
+	var resolved map[string]interface{}
+	for _, option := range options {
+		group, ok := option.(AliasGroup)
+		if !ok {
+			continue
+		}
+		if resolved == nil {
+			resolved = make(map[string]interface{}, len(items))
+			for name, value := range items {
+				resolved[name] = value
+			}
+		}
+
+		var winner interface{}
+		for _, alias := range group.Aliases {
+			value, present := resolved[alias]
+			if present && winner == nil && value != nil && value != "" {
+				winner = value
+			}
+			delete(resolved, alias)
+		}
+		if winner != nil {
+			resolved[string(group.Canonical)] = winner
+		}
+	}
+
+	if resolved == nil {
+		return items
+	}
+	return resolved
+}
+
+// Default is the default properties implementation (supports mutability), properties are kept in insertion order
 type Default struct {
-	pf          PropertyFactory
-	syncMap     sync.Map
-	syncMapSize uint
-	addPolicy   AddPropertyPolicy
-	addEvent    AddPropertyEvent
+	syncMapSize  int64 // accessed atomically, first so that it's 64-bit aligned on 32-bit platforms
+	pf           PropertyFactory
+	syncMap      sync.Map
+	addPolicy    AddPropertyPolicy
+	addEvent     AddPropertyEvent
+	deleteEvent  DeletePropertyEvent
+	updateEvent  UpdatePropertyEvent
+	expiry       ExpiryPolicy
+	clock        Clock
+	changedEvent PropertiesChangedEvent
+	batchMu      sync.Mutex
+	batchDepth   int
+	batch        []pendingChange
+	listIndexes  sync.Map
+	orderMu      sync.Mutex
+	order        []PropertyName // names in insertion order, guarded by orderMu
+	interner     Interner
+	interned     sync.Map // the values taken from the interner for each stored property, see intern
+	names        NameNormalizer
+	aliases      NameAliasFunc
+
+	defaultAllow     AllowAddFunc
+	defaultAllowText AllowAddTextFunc
 }
 
 func newDefaultProperties(ctx context.Context, pf PropertyFactory, options ...interface{}) *Default {
@@ -68,29 +285,199 @@ func newDefaultProperties(ctx context.Context, pf PropertyFactory, options ...in
 		if instance, ok := option.(AddPropertyEvent); ok {
 			result.addEvent = instance
 		}
+		if instance, ok := option.(DeletePropertyEvent); ok {
+			result.deleteEvent = instance
+		}
+		if instance, ok := option.(UpdatePropertyEvent); ok {
+			result.updateEvent = instance
+		}
+		if instance, ok := option.(ExpiryPolicy); ok {
+			result.expiry = instance
+		}
+		if instance, ok := option.(Clock); ok {
+			result.clock = instance
+		}
+		if instance, ok := option.(PropertiesChangedEvent); ok {
+			result.changedEvent = instance
+		}
+		if instance, ok := option.(AllowAddFunc); ok {
+			result.defaultAllow = instance
+		}
+		if instance, ok := option.(AllowAddTextFunc); ok {
+			result.defaultAllowText = instance
+		}
+		if instance, ok := option.(Interner); ok {
+			result.interner = instance
+		}
+		if instance, ok := option.(NameNormalizer); ok {
+			result.names = instance
+		}
+		if instance, ok := option.(NameAliasFunc); ok {
+			result.aliases = instance
+		}
 	}
 
 	return result
 }
 
+// NameNormalizer may be passed in EmptyMutable options to normalize names on store and lookup, so that e.g.
+// Named(ctx, "TITLE") finds a property added as "Title"; stored properties keep the name they were created with
+type NameNormalizer func(PropertyName) PropertyName
+
+// LowercaseNames is a NameNormalizer for case-insensitive names
+var LowercaseNames NameNormalizer = func(name PropertyName) PropertyName {
+	return PropertyName(strings.ToLower(string(name)))
+}
+
+// NameAliasFunc may be passed in EmptyMutable options (or set on DefaultPropertiesFactory) to rewrite incoming names
+// before properties are created and stored, e.g. "desc" into "description"; lookups resolve through it too
+type NameAliasFunc func(string) string
+
+// NameAliases returns a NameAliasFunc which rewrites the keys of aliases into their values, other names are kept
+func NameAliases(aliases map[string]string) NameAliasFunc {
+	return func(name string) string {
+		if canonical, ok := aliases[name]; ok {
+			return canonical
+		}
+		return name
+	}
+}
+
+// alias returns the canonical name for the given name
+func (p *Default) alias(name string) string {
+	if p.aliases == nil {
+		return name
+	}
+	return p.aliases(name)
+}
+
+// key returns the name properties are stored and looked up by, after aliasing and normalization
+func (p *Default) key(name PropertyName) PropertyName {
+	name = PropertyName(p.alias(string(name)))
+	if p.names == nil {
+		return name
+	}
+	return p.names(name)
+}
+
+// rangeStored runs the do function on all stored properties in insertion order, skipping expired ones when the
+// collection is expiry-aware
+func (p *Default) rangeStored(ctx context.Context, do func(Property) bool) {
+	p.orderMu.Lock()
+	names := make([]PropertyName, len(p.order))
+	copy(names, p.order)
+	p.orderMu.Unlock()
+
+	for _, name := range names {
+		value, ok := p.syncMap.Load(name)
+		if !ok {
+			// deleted since the names were copied
+			continue
+		}
+		prop := value.(Property)
+		if p.expired(ctx, prop) {
+			continue
+		}
+		if !do(prop) {
+			return
+		}
+	}
+}
+
+// expired returns true if the collection is expiry-aware and the property has expired, evicting it if configured
+func (p *Default) expired(ctx context.Context, prop Property) bool {
+	if p.expiry == 0 {
+		return false
+	}
+	if p.clock != nil {
+		ctx = ContextWithClock(ctx, p.clock)
+	}
+	if !Expired(ctx, prop) {
+		return false
+	}
+	if p.expiry == EvictExpired {
+		p.Delete(ctx, prop.Name(ctx))
+	}
+	return true
+}
+
 // DefaultAllowAdd is passed into AddMap returns true if the property should be added
 func DefaultAllowAdd(ctx context.Context, givenName string, givenValue interface{}, createdProp Property, options ...interface{}) (Property, bool, error) {
 	return createdProp, true, nil
 }
 
-// AddMap adds all the items in the given map
+// RejectEmptyNames may be passed into AddMap instead of DefaultAllowAdd to skip items whose name is blank or only
+// whitespace (e.g. an empty YAML key), rather than failing with ErrEmptyPropertyName or storing them
+func RejectEmptyNames(ctx context.Context, givenName string, givenValue interface{}, createdProp Property, options ...interface{}) (Property, bool, error) {
+	if strings.TrimSpace(givenName) == "" {
+		return createdProp, false, nil
+	}
+	return createdProp, true, nil
+}
+
+// AddMap adds all the items in the given map, it stops with the context error if ctx is done before all are added
 func (p *Default) AddMap(ctx context.Context, items map[string]interface{}, allow AllowAddFunc, options ...interface{}) (uint, error) {
 	if items == nil {
 		return 0, fmt.Errorf("items is Nil in properties.Default.AddMap")
 	}
 
+	items = applyAliasGroups(items, options...)
+
+	if hasAddMapOption(FirstSortedKeyWins, options...) {
+		return p.addMapFirstSortedKeyWins(ctx, items, allow, options...)
+	}
+
+	keys := make([]string, 0, len(items))
+	for name := range items {
+		keys = append(keys, name)
+	}
+
+	var count uint
+	for _, name := range orderedKeys(keys, options...) {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		_, ok, err := p.AddAnyChecked(ctx, name, items[name], allow, options...)
+		if err != nil {
+			return count, err
+		}
+		if ok {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (p *Default) addMapFirstSortedKeyWins(ctx context.Context, items map[string]interface{}, allow AllowAddFunc, options ...interface{}) (uint, error) {
+	keys := make([]string, 0, len(items))
+	for name := range items {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+
+	seen := make(map[PropertyName]bool, len(keys))
+	allowFirst := func(ctx context.Context, name string, value interface{}, prop Property, options ...interface{}) (Property, bool, error) {
+		if seen[p.key(prop.Name(ctx))] {
+			return prop, false, nil
+		}
+		if allow != nil {
+			return allow(ctx, name, value, prop, options...)
+		}
+		return prop, true, nil
+	}
+
 	var count uint
-	for name, value := range items {
-		_, ok, err := p.AddChecked(ctx, name, value, allow, options...)
+	for _, name := range keys {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		prop, ok, err := p.AddAnyChecked(ctx, name, items[name], allowFirst, options...)
 		if err != nil {
 			return count, err
 		}
 		if ok {
+			seen[p.key(prop.Name(ctx))] = true
 			count++
 		}
 	}
@@ -103,19 +490,68 @@ func DefaultAllowAddTextFunc(ctx context.Context, givenName string, givenValue s
 	return createdProp, true, nil
 }
 
-// AddTextMap adds all the items in the given map by trying to "smart parse" the text
+// AddTextMap adds all the items in the given map by trying to "smart parse" the text, it stops with the context
+// error if ctx is done before all are added
 func (p *Default) AddTextMap(ctx context.Context, items map[string]string, allow AllowAddTextFunc, options ...interface{}) (uint, error) {
 	if items == nil {
 		return 0, fmt.Errorf("items is Nil in properties.Default.AddTextMap")
 	}
 
+	if hasAddMapOption(FirstSortedKeyWins, options...) {
+		return p.addTextMapFirstSortedKeyWins(ctx, items, allow, options...)
+	}
+
+	keys := make([]string, 0, len(items))
+	for name := range items {
+		keys = append(keys, name)
+	}
+
+	var count uint
+	for _, name := range orderedKeys(keys, options...) {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		_, ok, err := p.AddParsedChecked(ctx, name, items[name], allow, options...)
+		if err != nil {
+			return count, err
+		}
+		if ok {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (p *Default) addTextMapFirstSortedKeyWins(ctx context.Context, items map[string]string, allow AllowAddTextFunc, options ...interface{}) (uint, error) {
+	keys := make([]string, 0, len(items))
+	for name := range items {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+
+	seen := make(map[PropertyName]bool, len(keys))
+	allowFirst := func(ctx context.Context, name string, value string, prop Property, options ...interface{}) (Property, bool, error) {
+		if seen[p.key(prop.Name(ctx))] {
+			return prop, false, nil
+		}
+		if allow != nil {
+			return allow(ctx, name, value, prop, options...)
+		}
+		return prop, true, nil
+	}
+
 	var count uint
-	for name, value := range items {
-		_, ok, err := p.AddParsedChecked(ctx, name, value, allow, options...)
+	for _, name := range keys {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		prop, ok, err := p.AddParsedChecked(ctx, name, items[name], allowFirst, options...)
 		if err != nil {
 			return count, err
 		}
 		if ok {
+			seen[p.key(prop.Name(ctx))] = true
 			count++
 		}
 	}
@@ -125,34 +561,63 @@ func (p *Default) AddTextMap(ctx context.Context, items map[string]string, allow
 
 // AddParsedChecked adds a single named property of a text value by "smart parsing" the value type
 func (p *Default) AddParsedChecked(ctx context.Context, name string, value string, allow AllowAddTextFunc, options ...interface{}) (Property, bool, error) {
+	name = p.alias(name)
 	prop, ok, err := p.pf.FromText(ctx, name, value, options...)
 	if err != nil {
 		return nil, false, err
 	}
 
+	// a value the factory rejected isn't offered to the allow func, which could otherwise accept a nil property
+	if !ok || prop == nil {
+		return prop, false, nil
+	}
+
+	if allow == nil {
+		allow = p.defaultAllowText
+	}
 	if allow != nil {
 		prop, ok, err = allow(ctx, name, value, prop, options...)
+		if err != nil {
+			return prop, false, err
+		}
 	}
 
-	if ok {
-		return p.AddProperty(ctx, prop)
+	if ok && prop != nil {
+		return p.AddProperty(ctx, prop, options...)
 	}
 	return prop, ok, nil
 }
 
-// AddChecked adds a single named property of any value type
+// AddChecked is an alias of AddAnyChecked
 func (p *Default) AddChecked(ctx context.Context, name string, value interface{}, allow AllowAddFunc, options ...interface{}) (Property, bool, error) {
+	return p.AddAnyChecked(ctx, name, value, allow, options...)
+}
+
+// AddAnyChecked adds a single named property of any value type
+func (p *Default) AddAnyChecked(ctx context.Context, name string, value interface{}, allow AllowAddFunc, options ...interface{}) (Property, bool, error) {
+	name = p.alias(name)
 	prop, ok, err := p.pf.FromAny(ctx, name, value, options...)
 	if err != nil {
 		return nil, false, err
 	}
 
+	// a value the factory rejected isn't offered to the allow func, which could otherwise accept a nil property
+	if !ok || prop == nil {
+		return prop, false, nil
+	}
+
+	if allow == nil {
+		allow = p.defaultAllow
+	}
 	if allow != nil {
 		prop, ok, err = allow(ctx, name, value, prop, options...)
+		if err != nil {
+			return prop, false, err
+		}
 	}
 
-	if ok {
-		return p.AddProperty(ctx, prop)
+	if ok && prop != nil {
+		return p.AddProperty(ctx, prop, options...)
 	}
 	return prop, ok, nil
 }
@@ -162,34 +627,154 @@ func (p *Default) AddParsed(ctx context.Context, name string, value string, opti
 	return p.AddParsedChecked(ctx, name, value, nil, options...)
 }
 
-// Add adds a single named property of any value type
+// Add is an alias of AddAny
 func (p *Default) Add(ctx context.Context, name string, value interface{}, options ...interface{}) (Property, bool, error) {
-	return p.AddChecked(ctx, name, value, nil, options...)
+	return p.AddAny(ctx, name, value, options...)
 }
 
-// AddProperty adds the given property into the instance
+// AddAny adds a single named property of any value type
+func (p *Default) AddAny(ctx context.Context, name string, value interface{}, options ...interface{}) (Property, bool, error) {
+	return p.AddAnyChecked(ctx, name, value, nil, options...)
+}
+
+// AddProperty adds the given property into the instance; the Default* property types (and the wrappers around them)
+// are stored as a copy, which is returned, so that assigning e.g. PropName on the given property afterwards can't
+// desync it from the name it's keyed by; custom property types are stored as given
 func (p *Default) AddProperty(ctx context.Context, givenProp Property, options ...interface{}) (Property, bool, error) {
-	finalProp := givenProp
+	finalProp := detach(givenProp)
 	if p.addPolicy != nil {
 		var add bool
 		var err error
-		finalProp, add, err = p.addPolicy.AllowAdd(ctx, givenProp, options...)
+		finalProp, add, err = p.addPolicy.AllowAdd(ctx, finalProp, options...)
 		if err != nil {
 			return givenProp, false, err
 		}
 		if !add {
 			return finalProp, false, nil
 		}
+		// the policy may hand back the given instance or one it keeps, so its result is detached too
+		finalProp = detach(finalProp)
+	}
+
+	stored, replaced, err := p.put(ctx, finalProp)
+	if err != nil {
+		return finalProp, false, err
+	}
+	if replaced != nil {
+		p.notify(ctx, PropertyChange{Kind: ChangeUpdated, Property: stored, Previous: replaced}, options...)
+		return stored, true, nil
+	}
+	p.notify(ctx, PropertyChange{Kind: ChangeAdded, Property: stored}, options...)
+	return stored, true, nil
+}
+
+// put stores the property without consulting the add policy or notifying observers; it returns the stored
+// (interned) property and the property it replaced, nil if the name is new
+func (p *Default) put(ctx context.Context, prop Property) (Property, Property, error) {
+	// the name is read once so the stored key can't disagree with the validated name
+	name := prop.Name(ctx)
+	if name == "" {
+		return nil, nil, ErrEmptyPropertyName
 	}
+	name = p.key(name)
 
-	p.syncMap.Store(finalProp.Name(ctx), finalProp)
-	p.syncMapSize++
+	prop = p.intern(ctx, prop)
+
+	// replacing an existing name keeps its original position
+	p.orderMu.Lock()
+	replaced, exists := p.syncMap.Load(name)
+	if !exists {
+		p.order = append(p.order, name)
+	}
+	p.syncMap.Store(name, prop)
+	p.orderMu.Unlock()
+
+	// an existing name is replaced rather than added so the size doesn't change
+	if exists {
+		p.release(ctx, replaced.(Property))
+		return prop, replaced.(Property), nil
+	}
+	atomic.AddInt64(&p.syncMapSize, 1)
+	return prop, nil, nil
+}
 
-	if p.addEvent != nil {
-		p.addEvent.PropertyAdded(ctx, finalProp, options...)
+// detach returns a shallow copy of the default property types, including wrapped ones, so the caller's instance
+// isn't shared with the collection
+func detach(prop Property) Property {
+	switch value := prop.(type) {
+	case *DefaultTextProperty:
+		copied := *value
+		return &copied
+	case *DefaultTextListProperty:
+		copied := *value
+		return &copied
+	case *DefaultFlagProperty:
+		copied := *value
+		return &copied
+	case *DefaultDateTimeProperty:
+		copied := *value
+		return &copied
+	case *DefaultCardinalProperty:
+		copied := *value
+		return &copied
+	case *DefaultCardinalListProperty:
+		copied := *value
+		return &copied
+	case *DefaultFloatListProperty:
+		copied := *value
+		return &copied
+	case *DefaultNumericTextProperty:
+		copied := *value
+		return &copied
+	case *DefaultDurationProperty:
+		copied := *value
+		return &copied
+	case *DefaultURLProperty:
+		copied := *value
+		return &copied
+	case *DefaultBigIntProperty:
+		copied := *value
+		return &copied
+	case *DefaultMapProperty:
+		copied := *value
+		return &copied
+	case *DefaultNestedProperty:
+		copied := *value
+		return &copied
+	case *DefaultExpiringProperty:
+		copied := *value
+		copied.Property = detach(value.Property)
+		return &copied
+	case *DefaultOriginProperty:
+		copied := *value
+		copied.Property = detach(value.Property)
+		return &copied
+	case *DefaultProvenanceProperty:
+		copied := *value
+		copied.Property = detach(value.Property)
+		return &copied
+	default:
+		return prop
 	}
+}
 
-	return finalProp, true, nil
+// AddProperties adds each of the given properties through AddProperty and returns the number added, it stops at
+// the first error (including the context error if ctx is done)
+func (p *Default) AddProperties(ctx context.Context, props []Property, options ...interface{}) (uint, error) {
+	var count uint
+	for _, prop := range props {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		_, ok, err := p.AddProperty(ctx, prop, options...)
+		if err != nil {
+			return count, err
+		}
+		if ok {
+			count++
+		}
+	}
+	return count, nil
 }
 
 // DeleteProperty removes the property
@@ -199,47 +784,160 @@ func (p *Default) DeleteProperty(ctx context.Context, prop Property, options ...
 
 // Delete removes the property with the given name
 func (p *Default) Delete(ctx context.Context, name PropertyName, options ...interface{}) (bool, error) {
-	_, ok := p.syncMap.Load(name)
+	// LoadAndDelete makes sure only one of several concurrent deletes of the same name decrements the size
+	name = p.key(name)
+	p.orderMu.Lock()
+	prop, ok := p.syncMap.LoadAndDelete(name)
 	if !ok {
+		p.orderMu.Unlock()
 		return false, nil
 	}
-	p.syncMap.Delete(name)
-	p.syncMapSize--
+	for i, ordered := range p.order {
+		if ordered == name {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+	p.orderMu.Unlock()
+	p.listIndexes.Delete(name)
+	atomic.AddInt64(&p.syncMapSize, -1)
+	p.release(ctx, prop.(Property))
+
+	p.notify(ctx, PropertyChange{Kind: ChangeDeleted, Property: prop.(Property)}, options...)
 	return true, nil
 }
 
-// Size returns the number of items in the list
+// Clear removes all the properties, firing a delete event for each, and returns how many were removed; the instance
+// can be reused afterwards
+func (p *Default) Clear(ctx context.Context, options ...interface{}) uint {
+	p.orderMu.Lock()
+	names := p.order
+	p.order = nil
+	removed := make([]Property, 0, len(names))
+	for _, name := range names {
+		if prop, ok := p.syncMap.LoadAndDelete(name); ok {
+			p.listIndexes.Delete(name)
+			removed = append(removed, prop.(Property))
+		}
+	}
+	p.orderMu.Unlock()
+	atomic.AddInt64(&p.syncMapSize, -int64(len(removed)))
+
+	for _, prop := range removed {
+		p.release(ctx, prop)
+		p.notify(ctx, PropertyChange{Kind: ChangeDeleted, Property: prop}, options...)
+	}
+	return uint(len(removed))
+}
+
+// MarshalJSON implements json.Marshaler, see ToJSON
+func (p *Default) MarshalJSON() ([]byte, error) {
+	return ToJSON(context.Background(), p)
+}
+
+// Size returns the number of items in the list, including expired properties which haven't been evicted
 func (p *Default) Size(context.Context) uint {
-	return p.syncMapSize
+	return uint(atomic.LoadInt64(&p.syncMapSize))
 }
 
-// List returns all the properties as a slice
-func (p *Default) List(context.Context, ...interface{}) []Property {
-	var result []Property
+// Recount re-derives the size by counting the stored entries (including expired ones which haven't been evicted yet),
+// resets the tracked size to match and returns it; it's only exact when no writes are in flight
+func (p *Default) Recount(ctx context.Context) uint {
+	stored := p.countStored()
+	atomic.StoreInt64(&p.syncMapSize, stored)
+	return uint(stored)
+}
+
+// countStored ranges the map to count the stored entries
+func (p *Default) countStored() int64 {
+	var stored int64
 	p.syncMap.Range(func(key, value interface{}) bool {
-		result = append(result, value.(Property))
+		stored++
+		return true
+	})
+	return stored
+}
+
+// verifySize is an invariant check for tests which counts the stored entries (including expired ones which haven't
+// been evicted yet) and compares them to the tracked size; it's only meaningful when no writes are in flight
+func (p *Default) verifySize(ctx context.Context) error {
+	stored := p.countStored()
+	if tracked := atomic.LoadInt64(&p.syncMapSize); tracked != stored {
+		return fmt.Errorf("tracked size %d doesn't match %d stored properties", tracked, stored)
+	}
+	return nil
+}
+
+// List returns all the properties as a slice in insertion order
+func (p *Default) List(ctx context.Context, options ...interface{}) []Property {
+	var result []Property
+	if size := p.Size(ctx); size > 0 {
+		result = make([]Property, 0, size)
+	}
+	p.rangeStored(ctx, func(prop Property) bool {
+		result = append(result, prop)
+		return true
+	})
+	return result
+}
+
+// Keys returns the property names in the same insertion order as List
+func (p *Default) Keys(ctx context.Context) []PropertyName {
+	result := make([]PropertyName, 0, p.Size(ctx))
+	p.rangeStored(ctx, func(prop Property) bool {
+		result = append(result, prop.Name(ctx))
+		return true
+	})
+	return result
+}
+
+// Values returns the AnyValue of each property in the same order as List and Keys
+func (p *Default) Values(ctx context.Context) []interface{} {
+	result := make([]interface{}, 0, p.Size(ctx))
+	p.rangeStored(ctx, func(prop Property) bool {
+		result = append(result, prop.AnyValue(ctx))
 		return true
 	})
 	return result
 }
 
+// Into appends all the properties into the given slice and returns it, allowing callers to reuse backing storage
+func (p *Default) Into(ctx context.Context, dst []Property, options ...interface{}) []Property {
+	p.rangeStored(ctx, func(prop Property) bool {
+		dst = append(dst, prop)
+		return true
+	})
+	return dst
+}
+
 // DefaultMapAssign is passed into Map() for default property assignment rule
-func DefaultMapAssign(ctx context.Context, p Property, dest map[string]interface{}, options ...interface{}) bool {
+func DefaultMapAssign(ctx context.Context, p Property, dest map[string]interface{}, options ...interface{}) (bool, bool) {
 	p.Copy(ctx, dest, options...)
-	return true
+	return true, true
 }
 
-// Map returns all the properties as a map
+// FillMissingAssign is passed into Map() to layer properties onto a pre-populated map, only keys which aren't
+// already in dest are assigned (and counted); it never stops the iteration
+func FillMissingAssign(ctx context.Context, p Property, dest map[string]interface{}, options ...interface{}) (bool, bool) {
+	if _, exists := dest[string(p.Name(ctx))]; exists {
+		return false, true
+	}
+	p.Copy(ctx, dest, options...)
+	return true, true
+}
+
+// Map assigns the properties into dest and returns the number the assign func counted, stopping early when it says
+// not to keep going; dest is written without synchronization so it must not be shared
+// with other goroutines while Map is running, use MapSafe when that can't be guaranteed
 func (p *Default) Map(ctx context.Context, dest map[string]interface{}, assign MapAssignFunc, options ...interface{}) uint {
 	if assign == nil {
 		assign = DefaultMapAssign
 	}
 
 	var count uint
-	p.syncMap.Range(func(key, value interface{}) bool {
-		property := value.(Property)
-		keepGoing := assign(ctx, property, dest, options...)
-		if keepGoing {
+	p.rangeStored(ctx, func(property Property) bool {
+		counted, keepGoing := assign(ctx, property, dest, options...)
+		if counted {
 			count++
 		}
 		return keepGoing
@@ -247,31 +945,425 @@ func (p *Default) Map(ctx context.Context, dest map[string]interface{}, assign M
 	return count
 }
 
+// MapSafe returns all the properties assigned into a freshly allocated map which isn't shared with any caller
+func (p *Default) MapSafe(ctx context.Context, assign MapAssignFunc, options ...interface{}) (map[string]interface{}, uint) {
+	dest := make(map[string]interface{}, p.Size(ctx))
+	count := p.Map(ctx, dest, assign, options...)
+	return dest, count
+}
+
+// MapOrdered returns the name and value of each property in insertion order, so serializers get a stable sequence
+// which a map can't provide
+func (p *Default) MapOrdered(ctx context.Context, options ...interface{}) []KeyValue {
+	result := make([]KeyValue, 0, p.Size(ctx))
+	p.rangeStored(ctx, func(prop Property) bool {
+		result = append(result, KeyValue{string(prop.Name(ctx)), prop.AnyValue(ctx)})
+		return true
+	})
+	return result
+}
+
 // Named returns the named property and true if it was found, false if not
 func (p *Default) Named(ctx context.Context, name PropertyName) (Property, bool) {
-	prop, ok := p.syncMap.Load(name)
-	if ok {
+	prop, ok := p.syncMap.Load(p.key(name))
+	if ok && !p.expired(ctx, prop.(Property)) {
 		return prop.(Property), true
 	}
 	return nil, false
 }
 
-// Filter returns the list of properties which match the filter criteria
+// Has returns true if the named property exists
+func (p *Default) Has(ctx context.Context, name PropertyName) bool {
+	_, ok := p.Named(ctx, name)
+	return ok
+}
+
+// Filter returns the list of properties which match the filter criteria, it always visits every property; use
+// FilterWhile to stop early
 func (p *Default) Filter(ctx context.Context, filter func(context.Context, Property) bool, options ...interface{}) []Property {
 	var result []Property
-	p.syncMap.Range(func(key, value interface{}) bool {
-		property := value.(Property)
+	p.rangeStored(ctx, func(property Property) bool {
 		if filter(ctx, property) {
+			if result == nil {
+				// best-effort pre-sizing, the number of matches isn't known up front
+				result = make([]Property, 0, p.Size(ctx))
+			}
+			result = append(result, property)
+		}
+		return true
+	})
+	return result
+}
+
+// FilterWhile returns the list of properties which fn includes, stopping as soon as fn says not to keep going (the
+// property fn was called with is still included if fn asked for it)
+func (p *Default) FilterWhile(ctx context.Context, fn FilterWhileFunc, options ...interface{}) []Property {
+	var result []Property
+	p.rangeStored(ctx, func(property Property) bool {
+		include, keepGoing := fn(ctx, property)
+		if include {
 			result = append(result, property)
 		}
+		return keepGoing
+	})
+	return result
+}
+
+// FilterByType returns the properties of the given kind (see KindOf) in insertion order
+func (p *Default) FilterByType(ctx context.Context, kind PropertyKind, options ...interface{}) []Property {
+	return p.Filter(ctx, func(ctx context.Context, prop Property) bool {
+		return KindOf(ctx, prop) == kind
+	}, options...)
+}
+
+// FilterMap returns the projected values of the properties which match the filter criteria, fn returns the
+// projected value and whether to include it; like Filter it always visits every property
+func (p *Default) FilterMap(ctx context.Context, fn func(context.Context, Property) (interface{}, bool), options ...interface{}) []interface{} {
+	var result []interface{}
+	p.rangeStored(ctx, func(property Property) bool {
+		if value, ok := fn(ctx, property); ok {
+			result = append(result, value)
+		}
 		return true
 	})
 	return result
 }
 
-// Range runs the do function on all entries
+// RangeMutable runs the do function on all entries in insertion order, deleting each property for which it returns
+// keep=false; returning ErrStopRange stops the iteration quietly while any other error stops it and is returned.
+// It returns the number of properties deleted.
+func (p *Default) RangeMutable(ctx context.Context, do func(context.Context, Property) (bool, error), options ...interface{}) (uint, error) {
+	var deleted uint
+	var err error
+	p.rangeStored(ctx, func(prop Property) bool {
+		var keep bool
+		keep, err = do(ctx, prop)
+		if !keep {
+			if ok, deleteErr := p.Delete(ctx, prop.Name(ctx), options...); deleteErr != nil {
+				err = deleteErr
+			} else if ok {
+				deleted++
+			}
+		}
+		return err == nil
+	})
+	if err == ErrStopRange {
+		err = nil
+	}
+	return deleted, err
+}
+
+// CountBy tallies the properties by the key the keyFn returns for each, e.g. KindOf(ctx, p).String() for kind counts
+func (p *Default) CountBy(ctx context.Context, keyFn func(context.Context, Property) string, options ...interface{}) map[string]uint {
+	counts := make(map[string]uint)
+	p.rangeStored(ctx, func(prop Property) bool {
+		counts[keyFn(ctx, prop)]++
+		return true
+	})
+	return counts
+}
+
+// Range runs the do function on all entries in insertion order until do returns false; it iterates over a snapshot
+// of the names, so do may add or delete properties (including the current one) and the size stays correct,
+// properties deleted before they are reached are skipped and properties added during the iteration aren't visited
 func (p *Default) Range(ctx context.Context, do func(context.Context, Property) bool, options ...interface{}) {
-	p.syncMap.Range(func(key, value interface{}) bool {
-		return do(ctx, value.(Property))
+	p.rangeStored(ctx, func(prop Property) bool {
+		return do(ctx, prop)
+	})
+}
+
+// EqualIgnoring returns true if both collections have equal properties, not counting the ignored names
+func (p *Default) EqualIgnoring(ctx context.Context, other Properties, ignore ...PropertyName) bool {
+	ignored := make(map[PropertyName]bool, len(ignore))
+	for _, name := range ignore {
+		ignored[name] = true
+	}
+
+	equal := true
+	p.Range(ctx, func(ctx context.Context, prop Property) bool {
+		if ignored[prop.Name(ctx)] {
+			return true
+		}
+		otherProp, ok := other.Named(ctx, prop.Name(ctx))
+		equal = ok && Equal(ctx, prop, otherProp)
+		return equal
+	})
+	if !equal {
+		return false
+	}
+
+	other.Range(ctx, func(ctx context.Context, prop Property) bool {
+		if ignored[prop.Name(ctx)] {
+			return true
+		}
+		_, equal = p.Named(ctx, prop.Name(ctx))
+		return equal
+	})
+	return equal
+}
+
+// MatchOption may be passed in HasListValue options to control how values are compared
+type MatchOption int
+
+const (
+	// IgnoreCase compares values case-insensitively (Unicode case folding)
+	IgnoreCase MatchOption = iota + 1
+)
+
+// textListIndex is a lazily built set of a text list's values
+type textListIndex struct {
+	source *DefaultTextListProperty
+	slice  []string // the indexed slice, so a value assigned in place through SetAnyValue is noticed
+	values map[string]struct{}
+	folded map[string]struct{}
+}
+
+func newTextListIndex(source *DefaultTextListProperty) *textListIndex {
+	index := &textListIndex{
+		source: source,
+		slice:  source.Slice,
+		values: make(map[string]struct{}, len(source.Slice)),
+		folded: make(map[string]struct{}, len(source.Slice)),
+	}
+	for _, value := range source.Slice {
+		index.values[value] = struct{}{}
+		index.folded[strings.ToLower(value)] = struct{}{}
+	}
+	return index
+}
+
+// indexes returns true if the index is still current for the given list
+func (index *textListIndex) indexes(list *DefaultTextListProperty) bool {
+	if index.source != list || len(index.slice) != len(list.Slice) {
+		return false
+	}
+	return len(list.Slice) == 0 || &index.slice[0] == &list.Slice[0]
+}
+
+// HasListValue returns true if the named TextListProperty contains the value; for the default text list type a
+// set index is built on first use (and rebuilt when the property is replaced) so repeated queries are cheap
+func (p *Default) HasListValue(ctx context.Context, name PropertyName, value string, options ...interface{}) bool {
+	prop, ok := p.Named(ctx, name)
+	if !ok {
+		return false
+	}
+	ignoreCase := false
+	for _, option := range options {
+		if instance, ok := option.(MatchOption); ok && instance == IgnoreCase {
+			ignoreCase = true
+		}
+	}
+
+	switch list := prop.(type) {
+	case *DefaultTextListProperty:
+		var index *textListIndex
+		if cached, ok := p.listIndexes.Load(p.key(name)); ok && cached.(*textListIndex).indexes(list) {
+			index = cached.(*textListIndex)
+		} else {
+			index = newTextListIndex(list)
+			p.listIndexes.Store(p.key(name), index)
+		}
+		if ignoreCase {
+			_, ok = index.folded[strings.ToLower(value)]
+		} else {
+			_, ok = index.values[value]
+		}
+		return ok
+	case TextListProperty:
+		for _, element := range list.Value(ctx) {
+			if element == value || (ignoreCase && strings.EqualFold(element, value)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Clone returns an independent copy with the same factory, policies, events and properties (in the same order);
+// the Default* properties (and the wrappers around them) are copied shallowly, so SetAnyValue on one collection's
+// property doesn't change the other's, while custom property types are shared; no events are fired while cloning
+func (p *Default) Clone(ctx context.Context) MutableProperties {
+	clone := &Default{
+		pf:               p.pf,
+		addPolicy:        p.addPolicy,
+		addEvent:         p.addEvent,
+		deleteEvent:      p.deleteEvent,
+		updateEvent:      p.updateEvent,
+		expiry:           p.expiry,
+		clock:            p.clock,
+		changedEvent:     p.changedEvent,
+		interner:         p.interner,
+		names:            p.names,
+		aliases:          p.aliases,
+		defaultAllow:     p.defaultAllow,
+		defaultAllowText: p.defaultAllowText,
+	}
+
+	p.orderMu.Lock()
+	defer p.orderMu.Unlock()
+	clone.order = make([]PropertyName, 0, len(p.order))
+	for _, name := range p.order {
+		if prop, ok := p.syncMap.Load(name); ok {
+			clone.syncMap.Store(name, clone.intern(ctx, detach(prop.(Property))))
+			clone.order = append(clone.order, name)
+		}
+	}
+	clone.syncMapSize = int64(len(clone.order))
+	return clone
+}
+
+// Merge copies the properties of other into this collection through AddProperty, so the add policy applies:
+//   - names only in other are added
+//   - names only in this collection are left untouched
+//   - names in both are passed to resolve; when it returns keep=true the winner is stored (nothing changes if the
+//     winner is of the same kind as the existing property and equals it) and when it returns keep=false the name
+//     is deleted entirely
+//
+// A nil resolve means the incoming property always wins. Merge returns the number of names which were added,
+// replaced or deleted and stops at the first error.
+func (p *Default) Merge(ctx context.Context, other Properties, resolve MergeConflictFunc, options ...interface{}) (uint, error) {
+	var count uint
+	var err error
+	other.Range(ctx, func(ctx context.Context, incoming Property) bool {
+		name := incoming.Name(ctx)
+		winner := incoming
+		if existing, exists := p.Named(ctx, name); exists {
+			if resolve != nil {
+				var keep bool
+				if winner, keep = resolve(ctx, existing, incoming); !keep {
+					var deleted bool
+					if deleted, err = p.Delete(ctx, name, options...); deleted {
+						count++
+					}
+					return err == nil
+				}
+			}
+			// Equal compares numbers across kinds, so e.g. a cardinal replaced by equal numeric text isn't skipped
+			if KindOf(ctx, winner) == KindOf(ctx, existing) && Equal(ctx, winner, existing) {
+				return true
+			}
+		}
+
+		var added bool
+		if _, added, err = p.AddProperty(ctx, winner, options...); added {
+			count++
+		}
+		return err == nil
+	})
+	return count, err
+}
+
+// ChangedSince returns the properties which are new or whose value differs from the same-named baseline property
+func (p *Default) ChangedSince(ctx context.Context, baseline Properties) []Property {
+	return p.Filter(ctx, func(ctx context.Context, prop Property) bool {
+		baselineProp, ok := baseline.Named(ctx, prop.Name(ctx))
+		return !ok || !Equal(ctx, prop, baselineProp)
+	})
+}
+
+// RemovedSince returns the names of the baseline properties which are no longer in this collection
+func (p *Default) RemovedSince(ctx context.Context, baseline Properties) []PropertyName {
+	var result []PropertyName
+	baseline.Range(ctx, func(ctx context.Context, prop Property) bool {
+		if !p.Has(ctx, prop.Name(ctx)) {
+			result = append(result, prop.Name(ctx))
+		}
+		return true
+	})
+	return result
+}
+
+// Diff classifies the names of a and b: added are only in b, removed are only in a and changed are in both with
+// different values (slices are deep-compared and times compared with time.Equal); added and changed follow b's
+// order while removed follows a's
+func Diff(ctx context.Context, a, b Properties) (added, removed, changed []PropertyName) {
+	b.Range(ctx, func(ctx context.Context, bProp Property) bool {
+		name := bProp.Name(ctx)
+		if aProp, ok := a.Named(ctx, name); !ok {
+			added = append(added, name)
+		} else if !Equal(ctx, aProp, bProp) {
+			changed = append(changed, name)
+		}
+		return true
+	})
+	a.Range(ctx, func(ctx context.Context, aProp Property) bool {
+		if !b.Has(ctx, aProp.Name(ctx)) {
+			removed = append(removed, aProp.Name(ctx))
+		}
+		return true
+	})
+	return added, removed, changed
+}
+
+// ReduceFunc folds a single property into the accumulated value
+type ReduceFunc[T any] func(ctx context.Context, acc T, p Property) T
+
+// Reduce folds all the properties into a single value, starting with init
+func Reduce[T any](ctx context.Context, props Properties, init T, fn ReduceFunc[T]) T {
+	acc := init
+	props.Range(ctx, func(ctx context.Context, p Property) bool {
+		acc = fn(ctx, acc, p)
+		return true
+	})
+	return acc
+}
+
+// TypedValues holds property values bucketed by their kind, keyed by property name
+type TypedValues struct {
+	Texts     map[string]string
+	TextLists map[string][]string
+	Flags     map[string]bool
+	DateTimes map[string]time.Time
+	Cardinals map[string]int64
+}
+
+// ExtractTyped buckets the values of all the properties by kind into strongly typed maps in a single pass,
+// properties of unknown (custom) types are skipped
+func ExtractTyped(ctx context.Context, props Properties) *TypedValues {
+	result := &TypedValues{
+		Texts:     make(map[string]string),
+		TextLists: make(map[string][]string),
+		Flags:     make(map[string]bool),
+		DateTimes: make(map[string]time.Time),
+		Cardinals: make(map[string]int64),
+	}
+
+	props.Range(ctx, func(ctx context.Context, p Property) bool {
+		name := string(p.Name(ctx))
+		switch prop := unwrap(p).(type) {
+		case TextProperty:
+			result.Texts[name] = prop.Value(ctx)
+		case TextListProperty:
+			result.TextLists[name] = prop.Value(ctx)
+		case FlagProperty:
+			result.Flags[name] = prop.Value(ctx)
+		case DateTimeProperty:
+			result.DateTimes[name] = prop.Value(ctx)
+		case CardinalProperty:
+			result.Cardinals[name] = prop.Value(ctx)
+		}
+		return true
 	})
+	return result
+}
+
+// CollectTextList gathers the named TextListProperty from each of the property sets and returns the merged,
+// deduplicated and sorted values, e.g. to build a tag index across many documents
+func CollectTextList(ctx context.Context, sets []Properties, name PropertyName) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, props := range sets {
+		values, ok := GetStringList(ctx, props, name)
+		if !ok {
+			continue
+		}
+		for _, value := range values {
+			if !seen[value] {
+				seen[value] = true
+				result = append(result, value)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
 }
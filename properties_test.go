@@ -2,11 +2,21 @@ package properties
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/araddon/dateparse"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/suite"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 const validFrontMatter = `
@@ -46,15 +56,15 @@ func (suite *PropertiesSuite) TestMutableProperties() {
 	suite.NotNil(props, "Ensure initialization")
 	suite.Equal(uint(0), props.Size(ctx), "Should be zero")
 
-	prop, ok, err := props.Add(ctx, "custom", suite)
+	prop, ok, err := props.AddAny(ctx, "custom", suite)
 	suite.False(ok, "Should not have been created")
-	suite.NotNil(err, "Should have gotten an error")
+	suite.True(errors.Is(err, ErrUnknownPropertyType), "Should have gotten an unknown type error")
 
 	prop, ok, err = props.Add(ctx, "text", "Test text")
 	suite.True(ok, "Should have been created")
 	suite.IsType(&DefaultTextProperty{}, prop, "Should have been created")
 
-	prop, ok, err = props.Add(ctx, "number", 100)
+	prop, ok, err = props.AddAny(ctx, "number", 100)
 	prop, ok, err = props.Add(ctx, "flag", true)
 	prop, ok, err = props.Add(ctx, "date", time.Now())
 	prop, ok, err = props.Add(ctx, "textList", []string{"one", "two"})
@@ -121,12 +131,2383 @@ func (suite *PropertiesSuite) TestInvalidFrontMatter() {
 	ctx := context.Background()
 	bodyBytes, props, count, err := suite.factory.MutableFromFrontMatter(ctx, []byte(invalidFrontMatter1), nil)
 
-	suite.EqualError(err, "Unexplained front matter parser error; insideFrontMatter: true, yamlStartIndex: 5, yamlEndIndex: 0")
+	suite.True(errors.Is(err, ErrUnterminatedFrontMatter), "The error should be testable with errors.Is")
+	suite.EqualError(err, `front matter has no closing fence: "---" expected after byte 5`)
 	suite.Nil(props, "Should not be initialized")
 	suite.Equal(uint(0), count, "Should not have any front matter")
 	suite.Nil(bodyBytes, "Body should be empty")
 }
 
+func (suite *PropertiesSuite) TestInto() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "text", "Test text")
+	props.Add(ctx, "number", 100)
+
+	dst := make([]Property, 0, 8)
+	dst = props.Into(ctx, dst)
+	suite.Equal(2, len(dst), "Should have appended both properties")
+	suite.Equal(8, cap(dst), "Should have reused the given backing storage")
+
+	dst = props.Into(ctx, dst[:0])
+	suite.Equal(2, len(dst), "Should have reset and appended both properties")
+}
+
+func (suite *PropertiesSuite) TestFrontMatterPopulatesItems() {
+	ctx := context.Background()
+	_, props, count, err := suite.factory.MutableFromFrontMatter(ctx, []byte("---\nfirst: one\nsecond: two\nthird: 3\n---\nbody"), nil)
+
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(3), count, "Should have three items")
+	suite.Equal(uint(3), props.Size(ctx), "Should have three items")
+
+	prop, ok := props.Named(ctx, "first")
+	suite.True(ok, "Should have been populated")
+	suite.Equal("one", prop.AnyValue(ctx))
+
+	prop, ok = props.Named(ctx, "third")
+	suite.True(ok, "Should have been populated")
+	suite.Equal(int64(3), prop.AnyValue(ctx))
+}
+
+func (suite *PropertiesSuite) TestEqualIgnoring() {
+	ctx := context.Background()
+	created := time.Now()
+
+	a := suite.factory.EmptyMutable(ctx)
+	a.Add(ctx, "title", "Test title")
+	a.Add(ctx, "tags", []string{"one", "two"})
+	a.Add(ctx, "created", created)
+	a.Add(ctx, "lastmod", created)
+
+	b := suite.factory.EmptyMutable(ctx)
+	b.Add(ctx, "title", "Test title")
+	b.Add(ctx, "tags", []string{"one", "two"})
+	b.Add(ctx, "created", created.UTC())
+	b.Add(ctx, "lastmod", created.Add(time.Hour))
+
+	suite.False(a.EqualIgnoring(ctx, b), "lastmod differs")
+	suite.True(a.EqualIgnoring(ctx, b, "lastmod"), "Should be equal when lastmod is ignored")
+	suite.True(b.EqualIgnoring(ctx, a, "lastmod"), "Should be symmetric")
+
+	b.Add(ctx, "draft", true)
+	suite.False(a.EqualIgnoring(ctx, b, "lastmod"), "draft is only in one set")
+	suite.True(a.EqualIgnoring(ctx, b, "lastmod", "draft"), "Should be equal when draft is ignored too")
+}
+
+func (suite *PropertiesSuite) TestStreamFromStringMap() {
+	ctx := context.Background()
+	items := map[string]interface{}{"text": "Test text", "number": 100, "flag": true}
+
+	var streamed []Property
+	err := suite.factory.StreamFromStringMap(ctx, items, func(ctx context.Context, prop Property) error {
+		streamed = append(streamed, prop)
+		return nil
+	})
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(3, len(streamed), "Should have streamed each item")
+
+	calls := 0
+	err = suite.factory.StreamFromStringMap(ctx, items, func(ctx context.Context, prop Property) error {
+		calls++
+		return fmt.Errorf("stop")
+	})
+	suite.EqualError(err, "stop")
+	suite.Equal(1, calls, "Should have stopped at the first error")
+}
+
+func (suite *PropertiesSuite) TestFirstSortedKeyWins() {
+	ctx := context.Background()
+	lowercase := func(ctx context.Context, prop Property, options ...interface{}) (Property, bool, error) {
+		return &DefaultTextProperty{PropertyName(strings.ToLower(string(prop.Name(ctx)))), prop.AnyValue(ctx).(string)}, true, nil
+	}
+	factory := &DefaultPropertiesFactory{PropFactory: &DefaultPropertyFactory{AfterCreateHookFunc: lowercase}}
+	items := map[string]interface{}{"title": "lower", "Title": "upper", "TITLE": "shout"}
+
+	for i := 0; i < 10; i++ {
+		props := factory.EmptyMutable(ctx)
+		count, err := props.AddMap(ctx, items, nil, FirstSortedKeyWins)
+		suite.Nil(err, "Shouldn't have any errors")
+		suite.Equal(uint(1), count, "All keys collapse into a single name")
+
+		prop, ok := props.Named(ctx, "title")
+		suite.True(ok, "Should have been added")
+		suite.Equal("shout", prop.AnyValue(ctx), "TITLE sorts first so it should win")
+	}
+
+	normalized := suite.factory.EmptyMutable(ctx, LowercaseNames)
+	count, err := normalized.AddMap(ctx, map[string]interface{}{"Title": "upper", "title": "lower"}, nil, FirstSortedKeyWins)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(1), count, "Both keys normalize to the same name")
+	prop, _ := normalized.Named(ctx, "title")
+	suite.Equal("upper", prop.AnyValue(ctx), "Title sorts first so it should win")
+
+	textNormalized := suite.factory.EmptyMutable(ctx, LowercaseNames)
+	textNormalized.AddTextMap(ctx, map[string]string{"Title": "upper", "title": "lower"}, nil, FirstSortedKeyWins)
+	prop, _ = textNormalized.Named(ctx, "title")
+	suite.Equal("upper", prop.AnyValue(ctx), "Title sorts first so it should win")
+}
+
+func (suite *PropertiesSuite) TestCoercionWarning() {
+	ctx := context.Background()
+	var warned []string
+	warn := CoercionWarningFunc(func(name string, original string, coerced Property) {
+		warned = append(warned, name)
+	})
+
+	prop, ok, err := ThePropertyFactory.FromText(ctx, "padded", "007", warn)
+	suite.True(ok, "Should have been created")
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(int64(7), prop.AnyValue(ctx))
+
+	prop, ok, err = ThePropertyFactory.FromText(ctx, "clean", "7", warn)
+	suite.True(ok, "Should have been created")
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(int64(7), prop.AnyValue(ctx))
+
+	suite.Equal([]string{"padded"}, warned, "Only 007 is a lossy coercion")
+}
+
+func (suite *PropertiesSuite) TestFrontMatterWithoutBody() {
+	ctx := context.Background()
+	bodyBytes, props, count, err := suite.factory.MutableFromFrontMatter(ctx, []byte("---\nkey: val\n---"), nil)
+
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.NotNil(props, "Should be initialized")
+	suite.Equal(uint(1), count, "Should have one item")
+	suite.Equal("", string(bodyBytes), "Body should be empty")
+
+	prop, ok := props.Named(ctx, "key")
+	suite.True(ok, "Should have been populated")
+	suite.Equal("val", prop.AnyValue(ctx))
+}
+
+func (suite *PropertiesSuite) TestReduce() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "one", 1)
+	props.Add(ctx, "two", 2)
+	props.Add(ctx, "text", "Test text")
+	props.Add(ctx, "three", int64(3))
+
+	sum := Reduce(ctx, props, int64(0), func(ctx context.Context, acc int64, p Property) int64 {
+		if cardinal, ok := p.(CardinalProperty); ok {
+			return acc + cardinal.Value(ctx)
+		}
+		return acc
+	})
+	suite.Equal(int64(6), sum, "Should have summed all cardinals")
+}
+
+func (suite *PropertiesSuite) TestExpiringProperty() {
+	start := time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	ctx := ContextWithNow(context.Background(), func() time.Time { return now })
+
+	for _, policy := range []ExpiryPolicy{SkipExpired, EvictExpired} {
+		now = start
+		props := suite.factory.EmptyMutable(ctx, policy)
+		props.Add(ctx, "text", "Test text")
+		props.AddProperty(ctx, &DefaultExpiringProperty{&DefaultTextProperty{"cached", "Cached text"}, start.Add(time.Minute)})
+
+		cached, ok := props.Named(ctx, "cached")
+		suite.True(ok, "Should be visible before its TTL passes")
+		suite.Equal(2, len(props.List(ctx)))
+		suite.Equal(KindText, KindOf(ctx, cached))
+		text, ok := GetString(ctx, props, "cached")
+		suite.True(ok, "Typed getters should see through the expiry wrapper")
+		suite.Equal("Cached text", text)
+
+		now = start.Add(time.Minute)
+		_, ok = props.Named(ctx, "cached")
+		suite.False(ok, "Should be invisible after its TTL passes")
+		suite.Equal(1, len(props.List(ctx)))
+
+		if policy == EvictExpired {
+			suite.Equal(uint(1), props.Size(ctx), "Should have been evicted")
+		} else {
+			suite.Equal(uint(2), props.Size(ctx), "Should still be stored")
+		}
+	}
+}
+
+func (suite *PropertiesSuite) TestExtractTyped() {
+	ctx := context.Background()
+	created := time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC)
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "title", "Test title")
+	props.Add(ctx, "tags", []string{"one", "two"})
+	props.Add(ctx, "draft", true)
+	props.Add(ctx, "created", created)
+	props.Add(ctx, "weight", 10)
+
+	typed := ExtractTyped(ctx, props)
+	suite.Equal(map[string]string{"title": "Test title"}, typed.Texts)
+	suite.Equal(map[string][]string{"tags": {"one", "two"}}, typed.TextLists)
+	suite.Equal(map[string]bool{"draft": true}, typed.Flags)
+	suite.Equal(map[string]time.Time{"created": created}, typed.DateTimes)
+	suite.Equal(map[string]int64{"weight": 10}, typed.Cardinals)
+}
+
+func (suite *PropertiesSuite) TestTextListSplitNames() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	split := TextListSplit{Delimiter: ",", Names: []PropertyName{"tags"}}
+	count, err := props.AddTextMap(ctx, map[string]string{
+		"tags":        "go, yaml,, front matter",
+		"description": "Parses, types, and stores properties",
+	}, nil, split)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(2), count)
+
+	prop, _ := props.Named(ctx, "tags")
+	suite.IsType(&DefaultTextListProperty{}, prop, "tags is eligible for splitting")
+	suite.Equal([]string{"go", "yaml", "front matter"}, prop.AnyValue(ctx))
+
+	prop, _ = props.Named(ctx, "description")
+	suite.IsType(&DefaultTextProperty{}, prop, "description isn't eligible for splitting")
+	suite.Equal("Parses, types, and stores properties", prop.AnyValue(ctx))
+}
+
+func (suite *PropertiesSuite) TestJSONValue() {
+	ctx := context.Background()
+	created := time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	suite.Equal("Test text", (&DefaultTextProperty{"text", "Test text"}).JSONValue(ctx))
+	suite.Equal([]string{"one", "two"}, (&DefaultTextListProperty{"tags", []string{"one", "two"}}).JSONValue(ctx))
+	suite.Equal(true, (&DefaultFlagProperty{"flag", true}).JSONValue(ctx))
+	suite.Equal(int64(221), (&DefaultCardinalProperty{"number", 221}).JSONValue(ctx))
+	suite.Equal("2019-06-01T12:00:00Z", (&DefaultDateTimeProperty{"created", created}).JSONValue(ctx))
+	suite.Equal("2019-06-01T12:00:00Z", (&DefaultExpiringProperty{&DefaultDateTimeProperty{"created", created}, created}).JSONValue(ctx))
+
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	suite.Equal("123456789012345678901234567890", (&DefaultBigIntProperty{"big", huge}).JSONValue(ctx), "Big ints are strings")
+	suite.Nil((&DefaultBigIntProperty{"big", nil}).JSONValue(ctx))
+}
+
+func (suite *PropertiesSuite) TestRebuildFrom() {
+	ctx := context.Background()
+	original := suite.factory.EmptyMutable(ctx)
+	original.Add(ctx, "text", "Test text")
+	original.Add(ctx, "number", 100)
+	original.Add(ctx, "tags", []string{"one", "two"})
+
+	rebuilt, count, err := suite.factory.RebuildFrom(ctx, original.List(ctx))
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(3), count)
+	suite.Equal(original.Size(ctx), rebuilt.Size(ctx))
+	suite.True(rebuilt.EqualIgnoring(ctx, original), "Should round-trip through List and RebuildFrom")
+}
+
+func (suite *PropertiesSuite) TestDegradedFrontMatter() {
+	ctx := context.Background()
+	content := "---\ntitle: Test title\nbroken: [unterminated\nauthor: Jane\n---\ntest body"
+	bodyBytes, props, count, err := suite.factory.MutableFromFrontMatter(ctx, []byte(content), nil)
+
+	suite.True(errors.Is(err, ErrDegradedFrontMatter), "Should have returned a soft error")
+	suite.Equal("test body", string(bodyBytes))
+	suite.Equal(uint(3), count, "Simple key: value lines should be salvaged")
+
+	prop, ok := props.Named(ctx, "title")
+	suite.True(ok, "Should have been salvaged")
+	suite.Equal("Test title", prop.AnyValue(ctx))
+
+	prop, ok = props.Named(ctx, "author")
+	suite.True(ok, "Should have been salvaged")
+	suite.Equal("Jane", prop.AnyValue(ctx))
+}
+
+func (suite *PropertiesSuite) TestPreserveNumericText() {
+	ctx := context.Background()
+	_, props, count, err := suite.factory.MutableFromFrontMatter(ctx, []byte("---\nprice: 3.50\n---\nbody"), nil, PreserveNumericText)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(1), count)
+
+	prop, _ := props.Named(ctx, "price")
+	suite.IsType(&DefaultNumericTextProperty{}, prop)
+	suite.Equal(3.5, prop.(NumericTextProperty).Float64(ctx), "Should be usable for computation")
+
+	dest := make(map[string]interface{})
+	props.Map(ctx, dest, nil)
+	out, err := yamlv3.Marshal(dest)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal("price: 3.50\n", string(out), "Should round-trip byte-for-byte")
+}
+
+func (suite *PropertiesSuite) TestMapSafe() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	for i := 0; i < 50; i++ {
+		props.Add(ctx, fmt.Sprintf("prop%d", i), i)
+	}
+
+	var wg sync.WaitGroup
+	results := make([]map[string]interface{}, 20)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = props.MapSafe(ctx, nil)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		suite.Equal(50, len(result), "Each caller should get its own complete map")
+		suite.Equal(int64(42), result["prop42"])
+	}
+}
+
+func (suite *PropertiesSuite) TestRelativeDates() {
+	now := time.Date(2019, time.June, 10, 12, 0, 0, 0, time.UTC)
+	ctx := ContextWithNow(context.Background(), func() time.Time { return now })
+
+	prop, _, err := ThePropertyFactory.FromText(ctx, "published", "yesterday", DefaultRelativeDates)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(now.AddDate(0, 0, -1), prop.AnyValue(ctx))
+
+	prop, _, err = ThePropertyFactory.FromText(ctx, "published", "2 days ago", DefaultRelativeDates)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(now.AddDate(0, 0, -2), prop.AnyValue(ctx))
+
+	prop, _, err = ThePropertyFactory.FromText(ctx, "published", "2 fortnights ago", DefaultRelativeDates)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal("2 fortnights ago", prop.AnyValue(ctx), "Unrecognized relatives fall through to text")
+}
+
+func (suite *PropertiesSuite) TestProvenance() {
+	ctx := context.Background()
+	original := &DefaultTextProperty{"Title", "  Test title  "}
+	suite.Nil(Provenance(ctx, original), "Shouldn't have any provenance yet")
+
+	renamed := WithProvenance(ctx, original, &DefaultTextProperty{"title", original.Text}, "renamed Title to title")
+	text := renamed.AnyValue(ctx).(string)
+	normalized := WithProvenance(ctx, renamed, &DefaultTextProperty{renamed.Name(ctx), strings.TrimSpace(text)}, "trimmed space")
+
+	suite.Equal(PropertyName("title"), normalized.Name(ctx))
+	suite.Equal("Test title", normalized.AnyValue(ctx))
+	suite.Equal([]string{"renamed Title to title", "trimmed space"}, Provenance(ctx, normalized))
+	suite.Equal([]string{"renamed Title to title"}, Provenance(ctx, renamed), "Earlier steps shouldn't be modified")
+
+	props := suite.factory.EmptyMutable(ctx)
+	props.AddProperty(ctx, normalized)
+	title, ok := GetString(ctx, props, "title")
+	suite.True(ok, "Typed getters should see through the provenance wrapper")
+	suite.Equal("Test title", title)
+}
+
+func (suite *PropertiesSuite) TestFilterMap() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "draft", true)
+	props.Add(ctx, "published", false)
+	props.Add(ctx, "featured", true)
+	props.Add(ctx, "title", "Test title")
+
+	names := props.FilterMap(ctx, func(ctx context.Context, p Property) (interface{}, bool) {
+		if flag, ok := p.(FlagProperty); ok && flag.Value(ctx) {
+			return string(p.Name(ctx)), true
+		}
+		return nil, false
+	})
+	suite.ElementsMatch([]interface{}{"draft", "featured"}, names)
+}
+
+func (suite *PropertiesSuite) TestFenceWithTrailingWhitespaceOrComment() {
+	ctx := context.Background()
+	for _, content := range []string{
+		"---  \ntitle: Test title\n---\t\ntest body",
+		"--- # front matter\ntitle: Test title\n--- # end\ntest body",
+	} {
+		bodyBytes, props, count, err := suite.factory.MutableFromFrontMatter(ctx, []byte(content), nil)
+		suite.Nil(err, "Shouldn't have any errors")
+		suite.Equal(uint(1), count, "Should have one item")
+		suite.Equal("test body", string(bodyBytes))
+		prop, _ := props.Named(ctx, "title")
+		suite.Equal("Test title", prop.AnyValue(ctx))
+	}
+
+	suite.False(isFrontMatterFence("---#note", "---"), "A comment needs whitespace after the fence")
+	suite.False(isFrontMatterFence("----", "---"), "Longer rules aren't fences")
+}
+
+func (suite *PropertiesSuite) TestFillMissingAssign() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "title", "Default title")
+	props.Add(ctx, "draft", true)
+
+	dest := map[string]interface{}{"title": "Page title"}
+	props.Map(ctx, dest, FillMissingAssign)
+	suite.Equal("Page title", dest["title"], "Existing keys shouldn't be overwritten")
+	suite.Equal(true, dest["draft"], "Missing keys should be filled")
+}
+
+func (suite *PropertiesSuite) TestHTMLCommentFrontMatter() {
+	ctx := context.Background()
+	content := "<!--\ntitle: Test title\nnumber: 221\n-->\n<p>test body</p>"
+	bodyBytes, props, count, err := suite.factory.MutableFromFrontMatter(ctx, []byte(content), nil, HTMLCommentFences)
+
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(2), count, "Should have two items")
+	suite.Equal("<p>test body</p>", string(bodyBytes))
+
+	prop, _ := props.Named(ctx, "title")
+	suite.Equal("Test title", prop.AnyValue(ctx))
+
+	bodyBytes, props, _, err = suite.factory.MutableFromFrontMatter(ctx, []byte(content), nil)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Nil(props, "HTML comments aren't front matter unless asked for")
+	suite.Equal(content, string(bodyBytes))
+}
+
+func (suite *PropertiesSuite) TestCopyOnWrite() {
+	ctx := context.Background()
+	base := suite.factory.EmptyMutable(ctx)
+	base.Add(ctx, "title", "Base title")
+	base.Add(ctx, "draft", true)
+	suite.Implements((*MutableProperties)(nil), NewCopyOnWrite(ctx, suite.factory, base))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cow := NewCopyOnWrite(ctx, suite.factory, base)
+			prop, _ := cow.Named(ctx, "title")
+			suite.Equal("Base title", prop.AnyValue(ctx), "Reads should fall through to the base")
+			suite.False(cow.Copied(ctx), "Reads shouldn't copy")
+
+			title := fmt.Sprintf("Local title %d", i)
+			cow.Add(ctx, "title", title)
+			cow.Delete(ctx, "draft")
+			suite.True(cow.Copied(ctx), "Writes should copy")
+
+			prop, _ = cow.Named(ctx, "title")
+			suite.Equal(title, prop.AnyValue(ctx), "Local writes should override the base")
+			_, ok := cow.Named(ctx, "draft")
+			suite.False(ok, "Local deletes should hide the base")
+		}(i)
+	}
+	wg.Wait()
+
+	prop, _ := base.Named(ctx, "title")
+	suite.Equal("Base title", prop.AnyValue(ctx), "The base should be isolated from local writes")
+	_, ok := base.Named(ctx, "draft")
+	suite.True(ok, "The base should be isolated from local deletes")
+	suite.Equal(uint(2), base.Size(ctx))
+
+	observer := &recordingObserver{}
+	cow := NewCopyOnWrite(ctx, suite.factory, base, observer, rejectNames{"title"})
+	cow.Add(ctx, "summary", "Local summary")
+	suite.Equal(1, len(observer.added), "Copying the base shouldn't announce the inherited properties")
+	suite.Equal(1, len(observer.batches))
+	suite.Equal(uint(3), cow.Size(ctx), "The add policy shouldn't drop inherited properties")
+}
+
+func (suite *PropertiesSuite) TestGetListValues() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "ids", []int64{1, 2, 3})
+	props.Add(ctx, "weights", []float64{0.5, 1.5})
+	props.Add(ctx, "tags", []string{"one", "two"})
+
+	ids, ok := GetInt64List(ctx, props, "ids")
+	suite.True(ok, "Should have found the cardinal list")
+	suite.Equal([]int64{1, 2, 3}, ids)
+
+	weights, ok := GetFloat64List(ctx, props, "weights")
+	suite.True(ok, "Should have found the float list")
+	suite.Equal([]float64{0.5, 1.5}, weights)
+
+	tags, ok := GetStringList(ctx, props, "tags")
+	suite.True(ok, "Should have found the text list")
+	suite.Equal([]string{"one", "two"}, tags)
+
+	_, ok = GetInt64List(ctx, props, "tags")
+	suite.False(ok, "A text list isn't a cardinal list")
+	_, ok = GetFloat64List(ctx, props, "missing")
+	suite.False(ok, "Missing properties aren't found")
+}
+
+func (suite *PropertiesSuite) TestAliasGroup() {
+	ctx := context.Background()
+	group := AliasGroup{Canonical: "description", Aliases: []string{"summary", "description", "excerpt"}}
+
+	props := suite.factory.EmptyMutable(ctx)
+	count, err := props.AddMap(ctx, map[string]interface{}{
+		"title":       "Test title",
+		"summary":     "",
+		"description": "From description",
+		"excerpt":     "From excerpt",
+	}, nil, group)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(2), count, "The aliases collapse into one property")
+
+	prop, _ := props.Named(ctx, "description")
+	suite.Equal("From description", prop.AnyValue(ctx), "description has precedence over excerpt and summary is empty")
+	_, ok := props.Named(ctx, "excerpt")
+	suite.False(ok, "Aliases shouldn't be stored")
+}
+
+func (suite *PropertiesSuite) TestFixedClock() {
+	ctx := context.Background()
+	clock := FixedClock(time.Date(2019, time.June, 10, 12, 0, 0, 0, time.UTC))
+
+	for i := 0; i < 3; i++ {
+		prop, _, err := ThePropertyFactory.FromText(ctx, "published", "yesterday", DefaultRelativeDates, clock)
+		suite.Nil(err, "Shouldn't have any errors")
+		suite.Equal(time.Date(2019, time.June, 9, 12, 0, 0, 0, time.UTC), prop.AnyValue(ctx), "Should be reproducible")
+	}
+
+	clockCtx := ContextWithClock(ctx, clock)
+	prop, _, _ := ThePropertyFactory.FromText(clockCtx, "published", "1 week ago", DefaultRelativeDates)
+	suite.Equal(time.Date(2019, time.June, 3, 12, 0, 0, 0, time.UTC), prop.AnyValue(ctx), "Should use the context's clock")
+
+	props := suite.factory.EmptyMutable(ctx, SkipExpired, clock)
+	props.AddProperty(ctx, &DefaultExpiringProperty{&DefaultTextProperty{"cached", "Cached text"}, time.Time(clock).Add(-time.Second)})
+	_, ok := props.Named(ctx, "cached")
+	suite.False(ok, "Expiry should use the collection's clock")
+}
+
+func (suite *PropertiesSuite) TestCollectTextList() {
+	ctx := context.Background()
+	var sets []Properties
+	for _, tags := range [][]string{{"go", "yaml"}, {"markdown", "go"}, {"yaml", "toml", "go"}} {
+		props := suite.factory.EmptyMutable(ctx)
+		props.Add(ctx, "tags", tags)
+		sets = append(sets, props)
+	}
+	sets = append(sets, suite.factory.EmptyMutable(ctx))
+
+	suite.Equal([]string{"go", "markdown", "toml", "yaml"}, CollectTextList(ctx, sets, "tags"))
+}
+
+func (suite *PropertiesSuite) TestEmptyNameRejected() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+
+	_, ok, err := props.AddProperty(ctx, &DefaultTextProperty{"", "Test text"})
+	suite.False(ok, "Should not have been added")
+	suite.Equal(ErrEmptyPropertyName, err)
+
+	_, ok, err = props.Add(ctx, "", "Test text")
+	suite.False(ok, "Should not have been added")
+	suite.Equal(ErrEmptyPropertyName, err)
+
+	suite.Equal(uint(0), props.Size(ctx), "Nothing should be stored under the empty key")
+	_, ok = props.Named(ctx, "")
+	suite.False(ok, "Nothing should be stored under the empty key")
+}
+
+func (suite *PropertiesSuite) TestRenameAfterAdd() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	title := &DefaultTextProperty{"title", "Test title"}
+	props.AddProperty(ctx, title)
+	props.Add(ctx, "draft", true)
+
+	title.PropName = "heading"
+	stored, ok := props.Named(ctx, "title")
+	suite.True(ok, "Should still be keyed by the name it was added with")
+	suite.Equal(PropertyName("title"), stored.Name(ctx), "The collection should hold its own copy")
+	suite.False(props.Has(ctx, "heading"))
+	suite.Equal([]PropertyName{"title", "draft"}, props.Keys(ctx))
+
+	deleted, err := props.Delete(ctx, "title")
+	suite.Nil(err)
+	suite.True(deleted, "Should be deletable under the original name")
+	suite.Equal(uint(1), props.Size(ctx))
+	suite.Nil(props.(*Default).verifySize(ctx))
+
+	policed := suite.factory.EmptyMutable(ctx, rejectNames{"secret"})
+	title = &DefaultTextProperty{"title", "Test title"}
+	policed.AddProperty(ctx, title)
+	title.PropName = "renamed"
+	stored, ok = policed.Named(ctx, "title")
+	suite.True(ok, "Should still be keyed by the name it was added with")
+	suite.Equal(PropertyName("title"), stored.Name(ctx), "A collection with a policy should hold its own copy too")
+}
+
+func (suite *PropertiesSuite) TestExplicitYAMLTags() {
+	ctx := context.Background()
+	content := "---\nflag: !!bool yes\nplain: yes\nnumber: !!int \"42\"\nhex: !!int 0x1F\ntext: !!str 123\nprice: !!float 3.50\n---\nbody"
+	_, props, count, err := suite.factory.MutableFromFrontMatter(ctx, []byte(content), nil, ExplicitYAMLTags)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(6), count)
+
+	prop, _ := props.Named(ctx, "flag")
+	suite.Equal(true, prop.AnyValue(ctx), "!!bool yes is a flag")
+	prop, _ = props.Named(ctx, "plain")
+	suite.Equal("yes", prop.AnyValue(ctx), "yes without a tag is text")
+	prop, _ = props.Named(ctx, "number")
+	suite.Equal(int64(42), prop.AnyValue(ctx), "!!int is a cardinal even when quoted")
+	prop, _ = props.Named(ctx, "hex")
+	suite.Equal(int64(31), prop.AnyValue(ctx), "!!int accepts hex literals")
+	prop, _ = props.Named(ctx, "text")
+	suite.Equal("123", prop.AnyValue(ctx), "!!str is text even when numeric")
+	prop, _ = props.Named(ctx, "price")
+	suite.Equal(NumericText("3.50"), prop.AnyValue(ctx), "!!float is numeric")
+
+	_, _, _, err = suite.factory.MutableFromFrontMatter(ctx, []byte("---\nflag: !!bool maybe\n---\nbody"), nil, ExplicitYAMLTags)
+	suite.NotNil(err, "An invalid tagged value should be an error")
+}
+
+type recordingObserver struct {
+	added        []Property
+	addedOptions [][]interface{}
+	deleted      []Property
+	updated      [][2]Property
+	batches      [][]PropertyChange
+}
+
+type changeSource string
+
+func (o *recordingObserver) PropertyAdded(ctx context.Context, p Property, options ...interface{}) {
+	o.added = append(o.added, p)
+	o.addedOptions = append(o.addedOptions, options)
+}
+
+func (o *recordingObserver) PropertyDeleted(ctx context.Context, p Property, options ...interface{}) {
+	o.deleted = append(o.deleted, p)
+}
+
+func (o *recordingObserver) PropertyUpdated(ctx context.Context, old Property, new Property, options ...interface{}) {
+	o.updated = append(o.updated, [2]Property{old, new})
+}
+
+func (o *recordingObserver) PropertiesChanged(ctx context.Context, changes []PropertyChange) {
+	o.batches = append(o.batches, changes)
+}
+
+func (suite *PropertiesSuite) TestBatchEvents() {
+	ctx := context.Background()
+	observer := &recordingObserver{}
+	props := suite.factory.EmptyMutable(ctx, observer)
+
+	props.Add(ctx, "before", "Not batched")
+	suite.Equal(1, len(observer.batches), "Unbatched changes are delivered immediately")
+
+	flush := props.BatchEvents(ctx)
+	props.Add(ctx, "text", "Test text", changeSource("editor"))
+	props.Add(ctx, "number", 100, changeSource("import"))
+	props.Delete(ctx, "before")
+	suite.Equal(1, len(observer.batches), "Batched changes are buffered")
+	suite.Equal(1, len(observer.added), "Batched changes are buffered")
+
+	flush()
+	suite.Equal(2, len(observer.batches), "Batched changes are coalesced into one delivery")
+	batch := observer.batches[1]
+	suite.Equal(3, len(batch))
+	suite.Equal(ChangeAdded, batch[0].Kind)
+	suite.Equal(PropertyName("number"), batch[1].Property.Name(ctx))
+	suite.Equal(ChangeDeleted, batch[2].Kind)
+	suite.Equal(3, len(observer.added), "Add events are delivered on flush")
+	suite.Equal([]interface{}{changeSource("editor")}, observer.addedOptions[1], "Each change keeps its own options")
+	suite.Equal([]interface{}{changeSource("import")}, observer.addedOptions[2])
+
+	flush()
+	suite.Equal(2, len(observer.batches), "Flushing twice shouldn't deliver again")
+}
+
+func (suite *PropertiesSuite) TestGluedClosingFence() {
+	ctx := context.Background()
+	bodyBytes, props, count, err := suite.factory.MutableFromFrontMatter(ctx, []byte("---\ntitle: Test title\nkey: value---\nbody"), nil)
+
+	suite.True(errors.Is(err, ErrGluedClosingFence), "The error should be testable with errors.Is")
+	suite.EqualError(err, `front matter closing fence is missing a preceding newline: "---" on line 3: "key: value---"`)
+	suite.Nil(props, "Should not be initialized")
+	suite.Equal(uint(0), count)
+	suite.Nil(bodyBytes, "Body should be empty")
+}
+
+func (suite *PropertiesSuite) TestChangedSince() {
+	ctx := context.Background()
+	baseline := suite.factory.EmptyMutable(ctx)
+	baseline.Add(ctx, "title", "Test title")
+	baseline.Add(ctx, "draft", true)
+	baseline.Add(ctx, "tags", []string{"one"})
+
+	current := suite.factory.EmptyMutable(ctx)
+	current.Add(ctx, "title", "Test title")
+	current.Add(ctx, "tags", []string{"one", "two"})
+	current.Add(ctx, "weight", 10)
+
+	var changed []PropertyName
+	for _, prop := range current.ChangedSince(ctx, baseline) {
+		changed = append(changed, prop.Name(ctx))
+	}
+	suite.ElementsMatch([]PropertyName{"tags", "weight"}, changed, "Modified and added properties, but not unchanged ones")
+	suite.Equal([]PropertyName{"draft"}, current.RemovedSince(ctx, baseline))
+	suite.Nil(baseline.ChangedSince(ctx, baseline), "Nothing changed")
+}
+
+func (suite *PropertiesSuite) TestTextNormalizer() {
+	ctx := context.Background()
+	lowercase := TextNormalizer{Normalize: strings.ToLower}
+
+	prop, _, err := ThePropertyFactory.FromAny(ctx, "tags", []string{"Go", "go", "GO"}, lowercase, DedupeTextList)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal([]string{"go"}, prop.AnyValue(ctx))
+
+	prop, _, _ = ThePropertyFactory.FromAny(ctx, "tags", []string{"Go", "go"}, lowercase)
+	suite.Equal([]string{"go", "go"}, prop.AnyValue(ctx), "Shouldn't dedupe unless asked")
+
+	prop, _, _ = ThePropertyFactory.FromAny(ctx, "title", "Test Title", lowercase)
+	suite.Equal("Test Title", prop.AnyValue(ctx), "Single text isn't normalized unless asked")
+
+	prop, _, _ = ThePropertyFactory.FromAny(ctx, "title", "Test Title", TextNormalizer{Normalize: strings.ToLower, IncludeText: true})
+	suite.Equal("test title", prop.AnyValue(ctx))
+}
+
+func (suite *PropertiesSuite) TestConvert() {
+	ctx := context.Background()
+
+	prop, err := Convert(ctx, &DefaultTextProperty{"number", "123"}, KindCardinal, ThePropertyFactory)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(KindCardinal, KindOf(ctx, prop))
+	suite.Equal(int64(123), prop.AnyValue(ctx))
+
+	prop, err = Convert(ctx, &DefaultTextProperty{"date", "2019-06-01"}, KindDateTime, ThePropertyFactory)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(time.Date(2019, time.June, 1, 0, 0, 0, 0, time.UTC), prop.AnyValue(ctx))
+
+	prop, err = Convert(ctx, &DefaultCardinalProperty{"number", 123}, KindText, ThePropertyFactory)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal("123", prop.AnyValue(ctx))
+
+	prop, err = Convert(ctx, &DefaultTextProperty{"date", "not a date"}, KindDateTime, ThePropertyFactory)
+	suite.EqualError(err, `unable to convert "date" property from text to date time: "not a date"`)
+	suite.Nil(prop)
+
+	for text, expected := range map[string]int64{"0": 0, "1": 1} {
+		prop, err = Convert(ctx, &DefaultTextProperty{"number", text}, KindCardinal, ThePropertyFactory)
+		suite.Nil(err, "%q shouldn't be claimed as a flag", text)
+		suite.Equal(expected, prop.AnyValue(ctx))
+	}
+	prop, err = Convert(ctx, &DefaultTextProperty{"ratio", "2.5"}, KindFloatList, ThePropertyFactory)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal([]float64{2.5}, prop.AnyValue(ctx))
+}
+
+func (suite *PropertiesSuite) TestHasListValue() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "tags", []string{"Go", "yaml"})
+	props.Add(ctx, "title", "Go")
+
+	suite.True(props.HasListValue(ctx, "tags", "Go"))
+	suite.True(props.HasListValue(ctx, "tags", "yaml"))
+	suite.False(props.HasListValue(ctx, "tags", "go"), "Comparison is case-sensitive by default")
+	suite.True(props.HasListValue(ctx, "tags", "go", IgnoreCase))
+	suite.False(props.HasListValue(ctx, "tags", "toml"))
+	suite.False(props.HasListValue(ctx, "title", "Go"), "Text isn't a list")
+	suite.False(props.HasListValue(ctx, "missing", "Go"))
+
+	props.Add(ctx, "tags", []string{"toml"})
+	suite.True(props.HasListValue(ctx, "tags", "toml"), "The index should be rebuilt when the property is replaced")
+	suite.False(props.HasListValue(ctx, "tags", "Go"), "The index should be rebuilt when the property is replaced")
+}
+
+func (suite *PropertiesSuite) TestDefaultAllowAdd() {
+	ctx := context.Background()
+	rejectSecret := AllowAddFunc(func(ctx context.Context, name string, value interface{}, prop Property, options ...interface{}) (Property, bool, error) {
+		return prop, name != "secret", nil
+	})
+	items := map[string]interface{}{"title": "Test title", "secret": "hunter2"}
+
+	props := suite.factory.EmptyMutable(ctx, rejectSecret)
+	count, err := props.AddMap(ctx, items, nil)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(1), count, "The default allow func should reject secret")
+	_, ok := props.Named(ctx, "secret")
+	suite.False(ok, "The default allow func should reject secret")
+
+	count, _ = props.AddMap(ctx, items, DefaultAllowAdd)
+	suite.Equal(uint(2), count, "An explicit allow func should override the default")
+
+	factory := &DefaultPropertiesFactory{PropFactory: ThePropertyFactory, AllowAdd: rejectSecret}
+	props, count, err = factory.MutableFromStringMap(ctx, items, nil)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(1), count, "The factory's allow func should be the default")
+
+	rejectEmpty := func(ctx context.Context, prop Property, options ...interface{}) (Property, bool, error) {
+		if prop.AnyValue(ctx) == "" {
+			return nil, false, nil
+		}
+		return prop, true, nil
+	}
+	acceptAll := AllowAddFunc(func(ctx context.Context, name string, value interface{}, prop Property, options ...interface{}) (Property, bool, error) {
+		return prop, true, nil
+	})
+	acceptAllText := AllowAddTextFunc(func(ctx context.Context, name string, value string, prop Property, options ...interface{}) (Property, bool, error) {
+		return prop, true, nil
+	})
+	factory = &DefaultPropertiesFactory{PropFactory: &DefaultPropertyFactory{AfterCreateHookFunc: rejectEmpty}, AllowAdd: acceptAll, AllowAddText: acceptAllText}
+	props = factory.EmptyMutable(ctx)
+	suite.NotPanics(func() {
+		_, ok, err = props.Add(ctx, "empty", "")
+	})
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.False(ok, "The default allow func shouldn't override the hook's rejection")
+	suite.NotPanics(func() {
+		_, ok, err = props.AddParsed(ctx, "empty", "")
+	})
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.False(ok, "The default allow func shouldn't override the hook's rejection")
+	suite.Equal(uint(0), props.Size(ctx))
+}
+
+func (suite *PropertiesSuite) TestInvalidYAMLFrontMatter() {
+	ctx := context.Background()
+	bodyBytes, props, count, err := suite.factory.MutableFromFrontMatter(ctx, []byte("---\n\tdescription: tab indented\n---\ntest body"), nil)
+
+	suite.NotNil(err, "The unmarshal error should be propagated")
+	suite.Contains(err.Error(), "unable to decode front matter at bytes 4-31")
+	suite.False(errors.Is(err, ErrDegradedFrontMatter), "Nothing could be salvaged")
+	suite.Nil(props, "Should not be initialized")
+	suite.Equal(uint(0), count)
+	suite.Nil(bodyBytes)
+}
+
+func (suite *PropertiesSuite) TestMapPropertyAsProperties() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "author", map[string]interface{}{"name": "Jane", "email": "jane@example.com", "posts": 12})
+
+	prop, _ := props.Named(ctx, "author")
+	suite.Equal(KindMap, KindOf(ctx, prop))
+
+	author, err := prop.(MapProperty).AsProperties(ctx, suite.factory)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(3), author.Size(ctx))
+
+	name, _ := author.Named(ctx, "name")
+	suite.Equal("Jane", name.AnyValue(ctx))
+	posts, _ := author.Named(ctx, "posts")
+	suite.Equal(int64(12), posts.AnyValue(ctx))
+}
+
+func (suite *PropertiesSuite) TestConcurrentSize() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			props.Add(ctx, fmt.Sprintf("kept%d", i), i)
+			props.Add(ctx, fmt.Sprintf("deleted%d", i), i)
+			props.Delete(ctx, PropertyName(fmt.Sprintf("deleted%d", i)))
+		}(i)
+	}
+	wg.Wait()
+
+	suite.Equal(uint(100), props.Size(ctx))
+	suite.Equal(100, len(props.List(ctx)))
+	suite.Nil(props.(*Default).verifySize(ctx))
+}
+
+func (suite *PropertiesSuite) TestSizeInvariantUnderChurn() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for round := 0; round < 50; round++ {
+				name := fmt.Sprintf("churn%d-%d", i, round%5)
+				props.Add(ctx, name, round)
+				props.Delete(ctx, PropertyName(name))
+				props.Delete(ctx, PropertyName(name))
+			}
+			props.Add(ctx, fmt.Sprintf("survivor%d", i), i)
+		}(i)
+	}
+	wg.Wait()
+
+	suite.Nil(props.(*Default).verifySize(ctx), "Size should match the stored entries after churn")
+	suite.Equal(uint(20), props.Size(ctx))
+}
+
+func (suite *PropertiesSuite) TestMergeConflicts() {
+	ctx := context.Background()
+	other := suite.factory.EmptyMutable(ctx)
+	other.Add(ctx, "title", "Incoming title")
+	other.Add(ctx, "draft", false)
+	other.Add(ctx, "weight", 10)
+
+	newTarget := func() MutableProperties {
+		target := suite.factory.EmptyMutable(ctx)
+		target.Add(ctx, "title", "Existing title")
+		target.Add(ctx, "draft", true)
+		target.Add(ctx, "author", "Jane")
+		return target
+	}
+
+	keepExisting := func(ctx context.Context, existing Property, incoming Property) (Property, bool) {
+		return existing, true
+	}
+	target := newTarget()
+	count, err := target.Merge(ctx, other, keepExisting)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(1), count, "Only the incoming-only weight should change")
+	prop, _ := target.Named(ctx, "title")
+	suite.Equal("Existing title", prop.AnyValue(ctx), "The winner should be kept")
+	prop, _ = target.Named(ctx, "weight")
+	suite.Equal(int64(10), prop.AnyValue(ctx), "Incoming-only names should be added")
+	prop, _ = target.Named(ctx, "author")
+	suite.Equal("Jane", prop.AnyValue(ctx), "Existing-only names should be untouched")
+
+	skipConflicts := func(ctx context.Context, existing Property, incoming Property) (Property, bool) {
+		return nil, false
+	}
+	target = newTarget()
+	count, err = target.Merge(ctx, other, skipConflicts)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(3), count, "Two deletions and one addition")
+	_, ok := target.Named(ctx, "title")
+	suite.False(ok, "keep=false should remove the name entirely")
+	_, ok = target.Named(ctx, "draft")
+	suite.False(ok, "keep=false should remove the name entirely")
+	suite.Equal(uint(2), target.Size(ctx))
+
+	target = newTarget()
+	count, _ = target.Merge(ctx, other, nil)
+	suite.Equal(uint(3), count, "Incoming properties win by default")
+	prop, _ = target.Named(ctx, "title")
+	suite.Equal("Incoming title", prop.AnyValue(ctx))
+
+	target = newTarget()
+	target.Add(ctx, "weight", 3)
+	numeric := suite.factory.EmptyMutable(ctx)
+	numeric.AddProperty(ctx, &DefaultNumericTextProperty{"weight", NumericText("3")})
+	count, _ = target.Merge(ctx, numeric, nil)
+	suite.Equal(uint(1), count, "A numerically equal value of another kind should still replace")
+	prop, _ = target.Named(ctx, "weight")
+	suite.Equal(KindNumericText, KindOf(ctx, prop))
+}
+
+func (suite *PropertiesSuite) TestTOMLFrontMatter() {
+	ctx := context.Background()
+	content := []byte(`
++++
+title = "Hugo post"
+draft = true
+weight = 5
+date = 2019-06-01T10:00:00Z
++++
+Body here.`)
+
+	body, props, count, err := suite.factory.MutableFromFrontMatter(ctx, content, nil)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(4), count)
+	suite.Equal("Body here.", string(body))
+
+	title, ok := props.Named(ctx, "title")
+	suite.True(ok)
+	suite.Equal("Hugo post", title.AnyValue(ctx))
+	draft, _ := props.Named(ctx, "draft")
+	suite.Equal(true, draft.AnyValue(ctx))
+	weight, _ := props.Named(ctx, "weight")
+	suite.Equal(int64(5), weight.AnyValue(ctx))
+	date, _ := props.Named(ctx, "date")
+	_, isDate := date.(DateTimeProperty)
+	suite.True(isDate, "TOML datetimes should become date properties")
+
+	_, _, _, err = suite.factory.MutableFromFrontMatter(ctx, []byte("+++\ntitle = \nbroken\n+++\nBody"), nil)
+	suite.NotNil(err, "Invalid TOML should be reported")
+}
+
+func (suite *PropertiesSuite) TestFrontMatterInto() {
+	ctx := context.Background()
+	content := []byte(`---
+title: Typed title
+weight: 7
+---
+Body`)
+
+	var typed struct {
+		Title  string `yaml:"title"`
+		Weight int    `yaml:"weight"`
+	}
+	body, props, count, err := suite.factory.MutableFromFrontMatterInto(ctx, content, &typed, nil)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal("Body", string(body))
+	suite.Equal("Typed title", typed.Title)
+	suite.Equal(7, typed.Weight)
+
+	suite.Equal(uint(2), count)
+	title, ok := props.Named(ctx, "title")
+	suite.True(ok)
+	suite.Equal("Typed title", title.AnyValue(ctx))
+}
+
+func (suite *PropertiesSuite) TestDetectFrontMatterFormat() {
+	suite.Equal(YAMLFrontMatter, DetectFrontMatterFormat([]byte("---\ntitle: x\n---\nbody")))
+	suite.Equal(TOMLFrontMatter, DetectFrontMatterFormat([]byte("\n+++\ntitle = \"x\"\n+++\nbody")))
+	suite.Equal(JSONFrontMatter, DetectFrontMatterFormat([]byte(`{"title": "x"}`+"\nbody")))
+	suite.Equal(YAMLFrontMatter, DetectFrontMatterFormat([]byte(noFrontMatter)), "YAML is the default")
+	suite.Equal("TOML", TOMLFrontMatter.String())
+
+	ctx := context.Background()
+	body, props, count, err := suite.factory.MutableFromFrontMatter(ctx, []byte(`{"title": "JSON {title}", "draft": true}
+JSON body`), nil)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(2), count)
+	suite.Equal("JSON body", string(body))
+	title, _ := props.Named(ctx, "title")
+	suite.Equal("JSON {title}", title.AnyValue(ctx))
+
+	body, props, _, err = suite.factory.MutableFromFrontMatter(ctx, []byte("{ not front matter }"), nil, YAMLFrontMatter)
+	suite.Nil(err, "Forcing YAML should skip JSON detection")
+	suite.Nil(props)
+	suite.Equal("{ not front matter }", string(body))
+
+	suite.Equal(JSONFrontMatter, DetectFrontMatterFormat([]byte("{\n\"unterminated\": ")), "A lone { opens JSON")
+	for _, content := range []string{"{{< youtube abc >}}\nShortcode body", "{ not json } text"} {
+		suite.Equal(YAMLFrontMatter, DetectFrontMatterFormat([]byte(content)))
+		body, props, _, err = suite.factory.MutableFromFrontMatter(ctx, []byte(content), nil)
+		suite.Nil(err, "Braces which aren't a JSON object should be left in the body")
+		suite.Nil(props)
+		suite.Equal(content, string(body))
+	}
+}
+
+func (suite *PropertiesSuite) TestJSONFrontMatter() {
+	ctx := context.Background()
+	content := []byte(`{
+  "description": "test description",
+  "number": 221,
+  "ratio": 2.50,
+  "flag": true,
+  "tags": ["one", "two"],
+  "scores": [1, 2.5]
+}
+test body`)
+
+	body, props, count, err := ThePropertiesFactory.MutableFromJSONFrontMatter(ctx, content, nil)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(6), count)
+	suite.Equal("test body", string(body))
+
+	number, _ := props.Named(ctx, "number")
+	suite.IsType(&DefaultCardinalProperty{}, number, "Integral JSON numbers should be cardinals")
+	suite.Equal(int64(221), number.AnyValue(ctx))
+	ratio, _ := props.Named(ctx, "ratio")
+	suite.Equal(NumericText("2.50"), ratio.AnyValue(ctx), "Fractional JSON numbers keep their text")
+	b, err := json.Marshal(map[string]interface{}{"ratio": NumericText("2.50"), "comma": NumericText("3,50"), "plus": NumericText("+5"), "hex": NumericText("0x1F")})
+	suite.Nil(err, "Numeric text which isn't a JSON number should still encode")
+	suite.Equal(`{"comma":"3,50","hex":"0x1F","plus":"+5","ratio":2.50}`, string(b))
+	tags, _ := props.Named(ctx, "tags")
+	suite.Equal([]string{"one", "two"}, tags.AnyValue(ctx))
+	scores, _ := props.Named(ctx, "scores")
+	suite.Equal([]float64{1, 2.5}, scores.AnyValue(ctx))
+
+	_, _, _, err = ThePropertiesFactory.MutableFromJSONFrontMatter(ctx, []byte(`{"unterminated": `), nil)
+	suite.NotNil(err, "Unbalanced JSON should be reported")
+
+	body, props, count, err = ThePropertiesFactory.MutableFromJSONFrontMatter(ctx, []byte(`Hello there {"a":1} rest`), nil)
+	suite.Nil(err)
+	suite.Equal(uint(0), count, "An object after other text isn't front matter")
+	suite.Nil(props)
+	suite.Equal(`Hello there {"a":1} rest`, string(body))
+}
+
+func (suite *PropertiesSuite) TestDecodeFrontMatter() {
+	ctx := context.Background()
+	body, raw, err := suite.factory.DecodeFrontMatter(ctx, []byte(`---
+description: test description
+number: 221
+flag: true
+---
+test body`))
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal("test body", string(body))
+	suite.Equal(map[string]interface{}{"description": "test description", "number": 221, "flag": true}, raw)
+
+	body, raw, err = suite.factory.DecodeFrontMatter(ctx, []byte(`{"number": 221, "ratio": 0.5}`+"\nbody"))
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(map[string]interface{}{"number": int64(221), "ratio": NumericText("0.5")}, raw, "JSON numbers should be normalized")
+
+	body, raw, err = suite.factory.DecodeFrontMatter(ctx, []byte(noFrontMatter))
+	suite.Nil(err)
+	suite.Nil(raw, "There is no front matter")
+	suite.Equal(noFrontMatter, string(body))
+}
+
+func (suite *PropertiesSuite) TestWriteFrontMatterRoundTrip() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "title", "Round trip")
+	props.Add(ctx, "tags", []string{"one", "two"})
+	props.Add(ctx, "date", time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC))
+	props.Add(ctx, "weight", 5)
+
+	var out strings.Builder
+	suite.Nil(WriteFrontMatter(ctx, &out, props, []byte("The body\n")))
+	suite.Equal(`---
+title: Round trip
+tags:
+  - one
+  - two
+date: 2019-06-01T10:00:00Z
+weight: 5
+---
+The body
+`, out.String())
+
+	body, reread, count, err := suite.factory.MutableFromFrontMatter(ctx, []byte(out.String()), nil)
+	suite.Nil(err, "Written front matter should parse")
+	suite.Equal(uint(4), count)
+	suite.Equal("The body", string(body))
+	title, _ := reread.Named(ctx, "title")
+	suite.Equal("Round trip", title.AnyValue(ctx))
+
+	_, reread, count, err = suite.factory.MutableFromFrontMatter(ctx, []byte("---\ntitle: No tags\ntags: []\n---\nThe body"), nil)
+	suite.Nil(err, "An empty sequence should parse")
+	suite.Equal(uint(2), count)
+	tags, _ := reread.Named(ctx, "tags")
+	suite.IsType(&DefaultTextListProperty{}, tags)
+	suite.Equal([]string{}, tags.AnyValue(ctx))
+}
+
+func (suite *PropertiesSuite) TestResolveReferences() {
+	ctx := context.Background()
+	content := []byte(`---
+title: Hello, Front Matter World!
+slug: "{{ .title | slugify }}"
+permalink: "/posts/{{ .slug }}/"
+---
+body`)
+
+	_, props, _, err := suite.factory.MutableFromFrontMatter(ctx, content, nil, ResolvePropertyReferences)
+	suite.Nil(err, "Shouldn't have any errors")
+	slug, _ := props.Named(ctx, "slug")
+	suite.Equal("hello-front-matter-world", slug.AnyValue(ctx))
+	permalink, _ := props.Named(ctx, "permalink")
+	suite.Equal("/posts/hello-front-matter-world/", permalink.AnyValue(ctx), "Templates may reference other templates")
+
+	cyclic := suite.factory.EmptyMutable(ctx)
+	cyclic.Add(ctx, "a", "{{ .b }}")
+	cyclic.Add(ctx, "b", "{{ .a }}")
+	_, err = ResolveReferences(ctx, cyclic)
+	suite.NotNil(err, "Reference cycles should be errors")
+	suite.Contains(err.Error(), "cycle")
+
+	missing := suite.factory.EmptyMutable(ctx)
+	missing.Add(ctx, "slug", "{{ .title }}")
+	_, err = ResolveReferences(ctx, missing)
+	suite.NotNil(err, "Missing references should be errors")
+
+	for i := 0; i < 10; i++ {
+		observer := &recordingObserver{}
+		ordered := suite.factory.EmptyMutable(ctx, observer)
+		ordered.Add(ctx, "title", "Hello")
+		for _, name := range []string{"zeta", "alpha", "mu", "beta"} {
+			ordered.Add(ctx, name, "{{ .title }}")
+		}
+		ResolveReferences(ctx, ordered)
+		var updated []PropertyName
+		for _, change := range observer.updated {
+			updated = append(updated, change[1].Name(ctx))
+		}
+		suite.Equal([]PropertyName{"zeta", "alpha", "mu", "beta"}, updated, "Resolved properties follow the collection's order")
+	}
+}
+
+func (suite *PropertiesSuite) TestInsertionOrder() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	names := []string{"zeta", "alpha", "mu", "beta", "omega", "delta"}
+	for i, name := range names {
+		props.Add(ctx, name, i)
+	}
+	props.Delete(ctx, "mu")
+	props.Add(ctx, "alpha", "replaced")
+	props.Add(ctx, "mu", "re-added")
+
+	var listed []string
+	for _, prop := range props.List(ctx) {
+		listed = append(listed, string(prop.Name(ctx)))
+	}
+	suite.Equal([]string{"zeta", "alpha", "beta", "omega", "delta", "mu"}, listed, "Replacing keeps the position, re-adding appends")
+
+	var ranged []string
+	props.Range(ctx, func(ctx context.Context, prop Property) bool {
+		ranged = append(ranged, string(prop.Name(ctx)))
+		return true
+	})
+	suite.Equal(listed, ranged)
+}
+
+func (suite *PropertiesSuite) TestFrontMatterDeclarationOrder() {
+	ctx := context.Background()
+	content := "---\nzeta: 1\nalpha: two\nmu: true\n---\nbody"
+	_, props, _, err := suite.factory.MutableFromFrontMatter(ctx, []byte(content), nil)
+	suite.Nil(err, "Shouldn't have any errors")
+
+	var out strings.Builder
+	suite.Nil(WriteFrontMatter(ctx, &out, props, []byte("body")))
+	suite.Equal(content, out.String(), "Round-tripping should keep the declared key order")
+
+	_, props, _, err = suite.factory.MutableFromFrontMatter(ctx, []byte(`{"zeta": {"nested": [1, 2]}, "alpha": [], "mu": "x"}`), nil, CustomCreatorFunc(func(ctx context.Context, name string, value interface{}, options ...interface{}) (Property, bool, error) {
+		return &DefaultTextProperty{PropertyName(name), fmt.Sprint(value)}, true, nil
+	}))
+	suite.Nil(err, "Shouldn't have any errors")
+	var names []PropertyName
+	for _, prop := range props.List(ctx) {
+		names = append(names, prop.Name(ctx))
+	}
+	suite.Equal([]PropertyName{"zeta", "alpha", "mu"}, names)
+}
+
+func (suite *PropertiesSuite) TestDurationProperty() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+
+	prop, ok, err := props.AddParsed(ctx, "readTime", "7m")
+	suite.True(ok)
+	suite.Nil(err)
+	duration, isDuration := prop.(DurationProperty)
+	suite.True(isDuration, "Text with a unit suffix should be a duration")
+	suite.Equal(7*time.Minute, duration.Value(ctx))
+	suite.Equal("7m0s", prop.JSONValue(ctx))
+	suite.Equal(KindDuration, KindOf(ctx, prop))
+
+	prop, _, _ = props.AddParsed(ctx, "travel", "2h30m")
+	suite.Equal(150*time.Minute, prop.AnyValue(ctx))
+
+	prop, _, _ = props.AddParsed(ctx, "number", "221")
+	suite.IsType(&DefaultCardinalProperty{}, prop, "A bare number must still be a cardinal")
+	prop, _, _ = props.AddParsed(ctx, "zero", "0")
+	suite.NotEqual(KindDuration, KindOf(ctx, prop), "A bare zero must not be a duration")
+
+	prop, _, _ = props.Add(ctx, "timeout", 90*time.Second)
+	suite.IsType(&DefaultDurationProperty{}, prop)
+}
+
+func (suite *PropertiesSuite) TestCountBy() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "alpha", "a")
+	props.Add(ctx, "apple", 1)
+	props.Add(ctx, "banana", true)
+	props.Add(ctx, "avocado", "c")
+
+	byFirstLetter := props.CountBy(ctx, func(ctx context.Context, p Property) string {
+		return string(p.Name(ctx)[:1])
+	})
+	suite.Equal(map[string]uint{"a": 3, "b": 1}, byFirstLetter)
+
+	byKind := props.CountBy(ctx, func(ctx context.Context, p Property) string {
+		return KindOf(ctx, p).String()
+	})
+	suite.Equal(map[string]uint{"text": 2, "cardinal": 1, "flag": 1}, byKind)
+	suite.Empty(suite.factory.EmptyMutable(ctx).CountBy(ctx, func(context.Context, Property) string { return "" }))
+}
+
+func (suite *PropertiesSuite) TestRefCountingInterner() {
+	ctx := context.Background()
+	interner := NewRefCountingInterner()
+
+	first := suite.factory.EmptyMutable(ctx, interner)
+	first.Add(ctx, "author", "Jane")
+	first.Add(ctx, "tags", []string{"go", "yaml"})
+	second := suite.factory.EmptyMutable(ctx, interner)
+	second.Add(ctx, "author", "Jane")
+	second.Add(ctx, "editor", "Sam")
+	suite.Equal(4, interner.Len(), "Jane, go, yaml and Sam should be pooled once each")
+
+	second.Add(ctx, "editor", "Alex")
+	suite.Equal(4, interner.Len(), "Replacing Sam should release it")
+
+	first.(*Default).Release(ctx)
+	suite.Equal(2, interner.Len(), "Jane is still referenced by the second collection")
+	suite.Equal(uint(0), first.Size(ctx))
+
+	second.(*Default).Release(ctx)
+	suite.Equal(0, interner.Len(), "The pool should shrink once every collection is released")
+
+	first.Add(ctx, "author", "Jane")
+	first.Add(ctx, "tags", []string{"go"})
+	author, _ := first.Named(ctx, "author")
+	suite.Nil(SetAnyValue(ctx, author, "Sam"))
+	tags, _ := first.Named(ctx, "tags")
+	suite.Nil(SetAnyValue(ctx, tags, []string{"yaml", "toml"}))
+	suite.Equal(2, interner.Len(), "The collection keeps its references to the values it interned")
+	first.(*Default).Release(ctx)
+	suite.Equal(0, interner.Len(), "The interned values should be released with the collection")
+}
+
+func (suite *PropertiesSuite) TestParseOptionsFlags() {
+	ctx := context.Background()
+	pf := suite.factory.PropertyFactory(ctx)
+
+	prop, _, _ := pf.FromText(ctx, "count", "1")
+	suite.IsType(&DefaultFlagProperty{}, prop, "The default stays compatible")
+
+	prop, _, _ = pf.FromText(ctx, "count", "1", ParseOptions{StrictFlags: true})
+	suite.IsType(&DefaultCardinalProperty{}, prop, "Strict flags leave 1 as a cardinal")
+	prop, _, _ = pf.FromText(ctx, "short", "T", ParseOptions{StrictFlags: true})
+	suite.IsType(&DefaultTextProperty{}, prop)
+	prop, _, _ = pf.FromText(ctx, "draft", "true", ParseOptions{StrictFlags: true})
+	suite.Equal(true, prop.AnyValue(ctx))
+
+	prop, _, _ = pf.FromText(ctx, "draft", "true", ParseOptions{DisableFlags: true})
+	suite.IsType(&DefaultTextProperty{}, prop, "Disabled flags keep true as text")
+	prop, _, _ = pf.FromText(ctx, "count", "0", ParseOptions{DisableFlags: true})
+	suite.Equal(int64(0), prop.AnyValue(ctx))
+}
+
+func (suite *PropertiesSuite) TestPropertyOrigin() {
+	ctx := context.Background()
+	pf := suite.factory.PropertyFactory(ctx)
+
+	parsed, _, _ := pf.FromText(ctx, "code", "007", TrackOrigin)
+	origin, ok := OriginOf(ctx, parsed)
+	suite.True(ok)
+	suite.Equal(OriginParsed, origin, "007 became a cardinal through smart parsing")
+	suite.Equal(int64(7), parsed.AnyValue(ctx))
+	suite.IsType(&DefaultCardinalProperty{}, parsed.(*DefaultOriginProperty).Unwrap())
+
+	explicit, _, _ := pf.FromAny(ctx, "code", 7, TrackOrigin)
+	origin, _ = OriginOf(ctx, explicit)
+	suite.Equal(OriginExplicit, origin)
+
+	custom, _, _ := pf.FromAny(ctx, "custom", suite, TrackOrigin, CustomCreatorFunc(func(ctx context.Context, name string, value interface{}, options ...interface{}) (Property, bool, error) {
+		return &DefaultTextProperty{PropertyName(name), "custom"}, true, nil
+	}))
+	origin, _ = OriginOf(ctx, custom)
+	suite.Equal(OriginCustom, origin)
+
+	untracked, _, _ := pf.FromText(ctx, "code", "007")
+	_, ok = OriginOf(ctx, untracked)
+	suite.False(ok, "Origins are only recorded when requested")
+}
+
+func (suite *PropertiesSuite) TestTypedGetters() {
+	ctx := context.Background()
+	published := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "title", "Getters")
+	props.Add(ctx, "weight", 3)
+	props.Add(ctx, "draft", true)
+	props.Add(ctx, "date", published)
+	props.Add(ctx, "tags", []string{"go"})
+	parsed, _, _ := suite.factory.PropertyFactory(ctx).FromText(ctx, "parsed", "42", TrackOrigin)
+	props.AddProperty(ctx, parsed)
+
+	title, ok := GetString(ctx, props, "title")
+	suite.True(ok)
+	suite.Equal("Getters", title)
+	weight, _ := GetInt(ctx, props, "weight")
+	suite.Equal(int64(3), weight)
+	draft, _ := GetBool(ctx, props, "draft")
+	suite.True(draft)
+	date, _ := GetTime(ctx, props, "date")
+	suite.Equal(published, date)
+	tags, _ := GetStringList(ctx, props, "tags")
+	suite.Equal([]string{"go"}, tags)
+	number, ok := GetInt(ctx, props, "parsed")
+	suite.True(ok, "Getters should see through origin wrappers")
+	suite.Equal(int64(42), number)
+
+	missing, ok := GetString(ctx, props, "missing")
+	suite.False(ok)
+	suite.Equal("", missing)
+	mismatched, ok := GetBool(ctx, props, "title")
+	suite.False(ok, "A text property isn't a flag")
+	suite.False(mismatched)
+}
+
+func (suite *PropertiesSuite) TestMustGetters() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "title", "Required")
+	props.Add(ctx, "weight", 3)
+
+	suite.Equal("Required", MustGetString(ctx, props, "title"))
+	suite.Equal(int64(3), MustGetInt(ctx, props, "weight"))
+	suite.PanicsWithValue(`required property "author" is missing, expected text`, func() {
+		MustGetString(ctx, props, "author")
+	})
+	suite.PanicsWithValue(`required property "title" is text (*properties.DefaultTextProperty), expected flag`, func() {
+		MustGetBool(ctx, props, "title")
+	})
+}
+
+func (suite *PropertiesSuite) TestDeleteDuringRange() {
+	ctx := context.Background()
+	newProps := func() MutableProperties {
+		props := suite.factory.EmptyMutable(ctx)
+		for i := 0; i < 10; i++ {
+			props.Add(ctx, fmt.Sprintf("p%d", i), i)
+		}
+		return props
+	}
+
+	props := newProps()
+	visited := 0
+	props.Range(ctx, func(ctx context.Context, prop Property) bool {
+		visited++
+		props.Delete(ctx, prop.Name(ctx))
+		return true
+	})
+	suite.Equal(10, visited, "Deleting the current property shouldn't disturb the iteration")
+	suite.Equal(uint(0), props.Size(ctx))
+
+	props = newProps()
+	index := 0
+	deleted, err := props.RangeMutable(ctx, func(ctx context.Context, prop Property) (bool, error) {
+		index++
+		return index%2 == 0, nil
+	})
+	suite.Nil(err)
+	suite.Equal(uint(5), deleted, "Every other property should be deleted")
+	suite.Equal(uint(5), props.Size(ctx))
+	suite.Nil(props.(*Default).verifySize(ctx))
+	_, ok := props.Named(ctx, "p0")
+	suite.False(ok)
+	_, ok = props.Named(ctx, "p1")
+	suite.True(ok)
+
+	deleted, err = props.RangeMutable(ctx, func(ctx context.Context, prop Property) (bool, error) {
+		return false, ErrStopRange
+	})
+	suite.Nil(err, "ErrStopRange should stop quietly")
+	suite.Equal(uint(1), deleted)
+}
+
+func (suite *PropertiesSuite) TestWriteFrontMatterSchemaOrder() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "weight", 5)
+	props.Add(ctx, "tags", []string{"go"})
+	props.Add(ctx, "author", "Jane")
+	props.Add(ctx, "title", "Schema")
+	props.Add(ctx, "date", time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC))
+
+	var out strings.Builder
+	suite.Nil(WriteFrontMatter(ctx, &out, props, nil, KeyOrder{"title", "date", "tags", "missing"}))
+	suite.Equal(`---
+title: Schema
+date: 2019-06-01T00:00:00Z
+tags:
+  - go
+author: Jane
+weight: 5
+---
+`, out.String(), "Schema names come first, the rest sorted")
+}
+
+func (suite *PropertiesSuite) TestURLProperty() {
+	ctx := context.Background()
+	pf := suite.factory.PropertyFactory(ctx)
+
+	prop, _, _ := pf.FromText(ctx, "homepage", "https://example.com/about")
+	suite.IsType(&DefaultTextProperty{}, prop, "URLs stay text unless requested")
+
+	prop, ok, err := pf.FromText(ctx, "homepage", "https://example.com/about", ParseOptions{URLs: true})
+	suite.True(ok)
+	suite.Nil(err)
+	link, isURL := prop.(URLProperty)
+	suite.True(isURL)
+	suite.Equal("example.com", link.Value(ctx).Host)
+	suite.Equal("https://example.com/about", prop.JSONValue(ctx))
+	suite.Equal(KindURL, KindOf(ctx, prop))
+
+	prop, _, _ = pf.FromText(ctx, "note", "mailto:someone@example.com", ParseOptions{URLs: true})
+	suite.IsType(&DefaultTextProperty{}, prop, "Only http and https URLs are recognized")
+
+	parsed, _ := url.Parse("http://example.org")
+	prop, _, _ = pf.FromAny(ctx, "site", parsed)
+	suite.IsType(&DefaultURLProperty{}, prop)
+
+	props := suite.factory.EmptyMutable(ctx)
+	props.AddProperty(ctx, prop)
+	var out strings.Builder
+	suite.Nil(WriteFrontMatter(ctx, &out, props, nil))
+	suite.Equal("---\nsite: http://example.org\n---\n", out.String())
+
+	props.AddProperty(ctx, &DefaultURLProperty{"site", nil})
+	b, err := ToJSON(ctx, props)
+	suite.Nil(err, "A nil URL shouldn't panic")
+	suite.Equal(`{"site":null}`, string(b))
+}
+
+func (suite *PropertiesSuite) TestCheckKinds() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "port", "8080 or so")
+	props.Add(ctx, "debug", 1)
+	props.Add(ctx, "name", "service")
+
+	errs := CheckKinds(ctx, props, map[PropertyName]PropertyKind{
+		"port":    KindCardinal,
+		"debug":   KindFlag,
+		"name":    KindText,
+		"timeout": KindDuration,
+	})
+	suite.Len(errs, 3, "Two mismatches and one missing key")
+	suite.EqualError(errs[0], `property "debug" is cardinal, expected flag`)
+	suite.EqualError(errs[1], `property "port" is text, expected cardinal`)
+	suite.EqualError(errs[2], `property "timeout" is missing, expected duration`)
+
+	suite.Empty(CheckKinds(ctx, props, map[PropertyName]PropertyKind{"name": KindText}))
+}
+
+func (suite *PropertiesSuite) TestFormatterRegistry() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "title", "Formatted")
+	props.Add(ctx, "date", time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC))
+	props.Add(ctx, "tags", []string{"a", "b"})
+
+	formatters := NewFormatterRegistry()
+	formatters.Register(KindDateTime, func(ctx context.Context, p Property) (string, error) {
+		return p.(DateTimeProperty).Value(ctx).Format("2006-01-02"), nil
+	})
+
+	var yamlOut strings.Builder
+	suite.Nil(WriteFrontMatter(ctx, &yamlOut, props, nil, formatters))
+	suite.Equal("---\ntitle: Formatted\ndate: \"2019-06-01\"\ntags:\n  - a\n  - b\n---\n", yamlOut.String())
+
+	var csvOut strings.Builder
+	suite.Nil(WriteCSV(ctx, &csvOut, props, formatters))
+	suite.Equal("title,Formatted\ndate,2019-06-01\ntags,\"a,b\"\n", csvOut.String())
+
+	csvOut.Reset()
+	suite.Nil(WriteCSV(ctx, &csvOut, props))
+	suite.Contains(csvOut.String(), "date,2019-06-01T10:00:00Z", "The default registry uses RFC3339")
+
+	structured := suite.factory.EmptyMutable(ctx)
+	structured.Add(ctx, "tags", []string{"a", "b"})
+	structured.Add(ctx, "params", map[string]interface{}{"published": time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC), "author": "jane"})
+	formatters.Register(KindText, func(ctx context.Context, p Property) (string, error) {
+		return strings.ToUpper(p.(TextProperty).Value(ctx)), nil
+	})
+	yamlOut.Reset()
+	suite.Nil(WriteFrontMatter(ctx, &yamlOut, structured, nil, formatters))
+	suite.Equal("---\ntags:\n  - A\n  - B\nparams:\n  author: JANE\n  published: \"2019-06-01\"\n---\n", yamlOut.String(),
+		"List elements and map values should use the registry too")
+}
+
+func (suite *PropertiesSuite) TestDeletePropertyEvent() {
+	ctx := context.Background()
+	observer := &recordingObserver{}
+	props := suite.factory.EmptyMutable(ctx, observer)
+	stored, _, _ := props.Add(ctx, "title", "Stored")
+
+	props.DeleteProperty(ctx, &DefaultTextProperty{"title", "Other value"})
+	suite.Equal([]Property{stored}, observer.deleted, "The stored property should be announced")
+
+	props.Delete(ctx, "missing")
+	suite.Len(observer.deleted, 1, "Deleting a missing name announces nothing")
+}
+
+type addOnlyObserver struct {
+	added []Property
+}
+
+func (o *addOnlyObserver) PropertyAdded(ctx context.Context, p Property, options ...interface{}) {
+	o.added = append(o.added, p)
+}
+
+func (suite *PropertiesSuite) TestOverwriteIsAnUpdate() {
+	ctx := context.Background()
+	observer := &recordingObserver{}
+	props := suite.factory.EmptyMutable(ctx, observer)
+	first, _, _ := props.Add(ctx, "title", "First")
+	second, _, _ := props.Add(ctx, "title", "Second")
+
+	suite.Equal(uint(1), props.Size(ctx), "Overwriting shouldn't grow the size")
+	suite.Nil(props.(*Default).verifySize(ctx))
+	suite.Equal([]Property{first}, observer.added, "Only the first add is an addition")
+	suite.Equal([][2]Property{{first, second}}, observer.updated)
+	suite.Equal(ChangeUpdated, observer.batches[1][0].Kind)
+	suite.Equal(first, observer.batches[1][0].Previous)
+
+	addOnly := &addOnlyObserver{}
+	props = suite.factory.EmptyMutable(ctx, addOnly)
+	first, _, _ = props.Add(ctx, "title", "First")
+	second, _, _ = props.Add(ctx, "title", "Second")
+	suite.Equal([]Property{first, second}, addOnly.added, "Observers without PropertyUpdated still see overwrites")
+
+	concurrent := suite.factory.EmptyMutable(ctx)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			concurrent.Add(ctx, fmt.Sprintf("shared%d", i%5), i)
+		}(i)
+	}
+	wg.Wait()
+	suite.Equal(uint(5), concurrent.Size(ctx))
+	suite.Nil(concurrent.(*Default).verifySize(ctx))
+}
+
+func (suite *PropertiesSuite) TestClone() {
+	ctx := context.Background()
+	observer := &recordingObserver{}
+	defaults := suite.factory.EmptyMutable(ctx, observer)
+	defaults.Add(ctx, "title", "Default title")
+	defaults.Add(ctx, "draft", false)
+	defaults.Add(ctx, "weight", 1)
+
+	clone := defaults.Clone(ctx)
+	suite.Equal(uint(3), clone.Size(ctx))
+	suite.Nil(clone.(*Default).verifySize(ctx))
+	suite.Len(observer.added, 3, "Cloning shouldn't fire events")
+
+	clone.Add(ctx, "title", "Page title")
+	clone.Delete(ctx, "draft")
+	clone.Add(ctx, "author", "Jane")
+	suite.Len(observer.updated, 1, "The clone keeps the events")
+
+	title, _ := GetString(ctx, defaults, "title")
+	suite.Equal("Default title", title, "Mutating the clone shouldn't touch the source")
+	suite.Equal(uint(3), defaults.Size(ctx))
+	_, ok := defaults.Named(ctx, "author")
+	suite.False(ok)
+
+	var names []PropertyName
+	for _, prop := range clone.List(ctx) {
+		names = append(names, prop.Name(ctx))
+	}
+	suite.Equal([]PropertyName{"title", "weight", "author"}, names)
+
+	cow := NewCopyOnWrite(ctx, suite.factory, defaults)
+	cow.Add(ctx, "local", true)
+	cowClone := cow.Clone(ctx)
+	cow.Add(ctx, "later", true)
+	suite.Equal(uint(4), cowClone.Size(ctx), "Copy-on-write clones are independent too")
+}
+
+type rejectNames []PropertyName
+
+func (r rejectNames) AllowAdd(ctx context.Context, p Property, options ...interface{}) (Property, bool, error) {
+	for _, name := range r {
+		if p.Name(ctx) == name {
+			return p, false, nil
+		}
+	}
+	return p, true, nil
+}
+
+func (suite *PropertiesSuite) TestLayeredMerge() {
+	ctx := context.Background()
+	site := suite.factory.EmptyMutable(ctx)
+	site.Add(ctx, "author", "Site author")
+	site.Add(ctx, "layout", "post")
+	site.Add(ctx, "secret", "not for pages")
+
+	page := suite.factory.EmptyMutable(ctx, rejectNames{"secret"})
+	page.Add(ctx, "author", "Page author")
+	page.Add(ctx, "title", "Page")
+
+	count, err := page.Merge(ctx, site, SkipConflicts)
+	suite.Nil(err)
+	suite.Equal(uint(1), count, "Only layout is new and allowed by the policy")
+	author, _ := GetString(ctx, page, "author")
+	suite.Equal("Page author", author, "Skipping keeps the page value")
+	_, ok := page.Named(ctx, "secret")
+	suite.False(ok, "The add policy is honored")
+
+	count, err = page.Merge(ctx, site, OverwriteConflicts)
+	suite.Nil(err)
+	suite.Equal(uint(1), count, "Only author changes, layout is already equal")
+	author, _ = GetString(ctx, page, "author")
+	suite.Equal("Site author", author)
+	suite.Equal(uint(3), page.Size(ctx))
+}
+
+func (suite *PropertiesSuite) TestDiff() {
+	ctx := context.Background()
+	published := time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)
+	before := suite.factory.EmptyMutable(ctx)
+	before.Add(ctx, "title", "Before")
+	before.Add(ctx, "tags", []string{"a", "b"})
+	before.Add(ctx, "date", published)
+	before.Add(ctx, "draft", true)
+
+	after := suite.factory.EmptyMutable(ctx)
+	after.Add(ctx, "title", "After")
+	after.Add(ctx, "tags", []string{"a", "b"})
+	after.Add(ctx, "date", published.In(time.FixedZone("EST", -5*60*60)))
+	after.Add(ctx, "author", "Jane")
+
+	added, removed, changed := Diff(ctx, before, after)
+	suite.Equal([]PropertyName{"author"}, added)
+	suite.Equal([]PropertyName{"draft"}, removed)
+	suite.Equal([]PropertyName{"title"}, changed, "Equal slices and instants aren't changes")
+
+	added, removed, changed = Diff(ctx, before, before)
+	suite.Empty(added)
+	suite.Empty(removed)
+	suite.Empty(changed)
+}
+
+func (suite *PropertiesSuite) TestEarlyTermination() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	for i := 0; i < 6; i++ {
+		props.Add(ctx, fmt.Sprintf("p%d", i), i)
+	}
+
+	visited := 0
+	props.Range(ctx, func(ctx context.Context, p Property) bool {
+		visited++
+		return visited < 2
+	})
+	suite.Equal(2, visited, "Range stops when do returns false")
+
+	visited = 0
+	matched := props.Filter(ctx, func(ctx context.Context, p Property) bool {
+		visited++
+		return false
+	})
+	suite.Nil(matched)
+	suite.Equal(6, visited, "Filter never stops early")
+
+	matched = props.FilterWhile(ctx, func(ctx context.Context, p Property) (bool, bool) {
+		number := p.AnyValue(ctx).(int64)
+		return number%2 == 0, number < 3
+	})
+	suite.Len(matched, 2, "p0 and p2 are included, the iteration stops at p3")
+
+	dest := make(map[string]interface{})
+	count := props.Map(ctx, dest, func(ctx context.Context, p Property, dest map[string]interface{}, options ...interface{}) (bool, bool) {
+		p.Copy(ctx, dest)
+		return p.Name(ctx) != "p0", len(dest) < 3
+	})
+	suite.Equal(uint(2), count, "Counting is separate from continuing")
+	suite.Len(dest, 3, "Map stops after the third assignment")
+
+	dest = map[string]interface{}{"p1": "kept"}
+	suite.Equal(uint(5), props.Map(ctx, dest, FillMissingAssign), "Only filled keys are counted")
+}
+
+func (suite *PropertiesSuite) TestNestedProperty() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	_, _, err := props.Add(ctx, "author", map[string]interface{}{
+		"name":   "Jane",
+		"posts":  12,
+		"social": map[interface{}]interface{}{"twitter": "@jane"},
+	})
+	suite.Nil(err, "Shouldn't have any errors")
+
+	prop, _ := props.Named(ctx, "author")
+	suite.Equal(KindMap, KindOf(ctx, prop))
+	nested, ok := unwrap(prop).(NestedProperty)
+	suite.True(ok, "Maps should become nested properties")
+	suite.Equal(uint(3), nested.Nested(ctx).Size(ctx))
+	posts, _ := GetInt(ctx, nested.Nested(ctx), "posts")
+	suite.Equal(int64(12), posts)
+
+	social, _ := nested.Nested(ctx).Named(ctx, "social")
+	_, ok = unwrap(social).(NestedProperty)
+	suite.True(ok, "yaml.v2 style maps should be nested recursively")
+
+	dest := make(map[string]interface{})
+	prop.Copy(ctx, dest)
+	suite.Equal(map[string]interface{}{"author": map[string]interface{}{
+		"name":   "Jane",
+		"posts":  int64(12),
+		"social": map[string]interface{}{"twitter": "@jane"},
+	}}, dest)
+}
+
+func (suite *PropertiesSuite) TestNestedYAMLFrontMatter() {
+	ctx := context.Background()
+	content := "---\ntitle: Post\nauthor:\n  name: Jane\n  email: j@x.com\n  social:\n    twitter: \"@jane\"\n---\nBody"
+	_, props, count, err := suite.factory.MutableFromFrontMatter(ctx, []byte(content), nil)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(2), count)
+
+	prop, ok := props.Named(ctx, "author")
+	suite.True(ok, "author should be found")
+	author, ok := unwrap(prop).(NestedProperty)
+	suite.True(ok, "yaml.v2 nested mappings should become nested properties")
+	suite.Equal("j@x.com", MustGetString(ctx, author.Nested(ctx), "email"))
+	suite.Equal([]PropertyName{"name", "email", "social"}, author.Nested(ctx).Keys(ctx), "Nested keys should keep their declaration order")
+
+	split := TextListSplit{Delimiter: ","}
+	content = "---\ntags: a, b\nauthor:\n  name: Doe, Jane\n  aka: J\n---\nBody"
+	_, props, _, err = suite.factory.MutableFromFrontMatter(ctx, []byte(content), nil, split, AliasGroup{Canonical: "name", Aliases: []string{"aka"}})
+	suite.Nil(err, "Shouldn't have any errors")
+	tags, _ := GetStringList(ctx, props, "tags")
+	suite.Equal([]string{"a", "b"}, tags)
+	prop, _ = props.Named(ctx, "author")
+	nested := unwrap(prop).(NestedProperty).Nested(ctx)
+	suite.Equal("Doe, Jane", MustGetString(ctx, nested, "name"), "Top-level options shouldn't apply to nested maps")
+	suite.Equal([]PropertyName{"name", "aka"}, nested.Keys(ctx))
+
+	for _, content := range []string{
+		"{\"author\": {\"name\": \"Jane\", \"email\": \"j@x.com\", \"links\": [\"/a\"]}}\nBody",
+		"+++\n[author]\nname = \"Jane\"\nemail = \"j@x.com\"\nlinks = [\"/a\"]\n+++\nBody",
+	} {
+		_, props, _, err = suite.factory.MutableFromFrontMatter(ctx, []byte(content), nil)
+		suite.Nil(err, "Shouldn't have any errors")
+		prop, _ = props.Named(ctx, "author")
+		suite.Equal([]PropertyName{"name", "email", "links"}, unwrap(prop).(NestedProperty).Nested(ctx).Keys(ctx))
+	}
+
+	converted, err := StringKeyedMap(map[interface{}]interface{}{
+		"links": []interface{}{map[interface{}]interface{}{"href": "/a"}},
+	})
+	suite.Nil(err, "String keys should convert")
+	suite.Equal(map[string]interface{}{"links": []interface{}{map[string]interface{}{"href": "/a"}}}, converted)
+
+	_, _, err = suite.factory.PropertyFactory(ctx).FromAny(ctx, "ids", map[interface{}]interface{}{1: "one"})
+	suite.NotNil(err, "Non-string keys can't be converted")
+	suite.Contains(err.Error(), "map key 1 is int")
+	suite.True(errors.Is(err, ErrUnknownPropertyType), "The error should be testable with errors.Is")
+}
+
+func (suite *PropertiesSuite) TestCRLFFrontMatter() {
+	ctx := context.Background()
+	content := "---\r\ntitle: Windows\r\nsummary: |\r\n  first\r\n  second\r\n---\r\n\r\nBody line\r\nNext line\r\n"
+	bodyBytes, props, count, err := suite.factory.MutableFromFrontMatter(ctx, []byte(content), nil)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(2), count)
+	suite.Equal("Body line\r\nNext line", string(bodyBytes), "The body shouldn't start with a carriage return")
+	suite.Equal("Windows", MustGetString(ctx, props, "title"))
+	suite.Equal("first\nsecond\n", MustGetString(ctx, props, "summary"), "Multi-line values shouldn't keep carriage returns")
+}
+
+func (suite *PropertiesSuite) TestByteOrderMarkFrontMatter() {
+	ctx := context.Background()
+	content := "\ufeff---\ntitle: Exported\n---\nBody"
+	bodyBytes, props, count, err := suite.factory.MutableFromFrontMatter(ctx, []byte(content), nil)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(1), count)
+	suite.Equal("Exported", MustGetString(ctx, props, "title"))
+	suite.Equal("Body", string(bodyBytes))
+
+	bodyBytes, _, _, err = suite.factory.MutableFromFrontMatter(ctx, []byte("\ufeffNo front matter"), nil)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal("No front matter", string(bodyBytes), "The byte order mark shouldn't be kept in the body")
+	suite.Equal(TOMLFrontMatter, DetectFrontMatterFormat([]byte("\ufeff+++\ntitle = \"x\"\n+++\n")))
+}
+
+func (suite *PropertiesSuite) TestFrontMatterStartModes() {
+	ctx := context.Background()
+	indented := "\n   \n---\ntitle: Indented\n---\nBody"
+	commented := "<!-- draft -->\n---\ntitle: Commented\n---\nBody"
+
+	_, props, _, err := suite.factory.MutableFromFrontMatter(ctx, []byte(indented), nil, StrictFrontMatterStart)
+	suite.Nil(err, "Leading whitespace is allowed in strict mode")
+	suite.Equal("Indented", MustGetString(ctx, props, "title"))
+
+	_, props, _, err = suite.factory.MutableFromFrontMatter(ctx, []byte(commented), nil, StrictFrontMatterStart)
+	suite.NotNil(err, "Content before the opening fence is an error in strict mode")
+	suite.True(errors.Is(err, ErrFrontMatterStart), "The error should be testable with errors.Is")
+	suite.Contains(err.Error(), `found "<!-- draft -->" on line 1`)
+	suite.Nil(props)
+
+	_, _, _, err = suite.factory.MutableFromFrontMatter(ctx, []byte(noFrontMatter), nil, StrictFrontMatterStart)
+	suite.NotNil(err, "Missing front matter is an error in strict mode")
+
+	_, props, _, err = suite.factory.MutableFromFrontMatter(ctx, []byte(indented), nil, LenientFrontMatterStart)
+	suite.Nil(err, "Leading blank lines are skipped in lenient mode")
+	suite.Equal(uint(1), props.Size(ctx))
+
+	bodyBytes, props, count, err := suite.factory.MutableFromFrontMatter(ctx, []byte(commented), nil, LenientFrontMatterStart)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Nil(props, "Content before the opening fence means there's no front matter in lenient mode")
+	suite.Equal(uint(0), count)
+	suite.Equal(commented, string(bodyBytes), "The entire content is body")
+}
+
+func (suite *PropertiesSuite) TestKeys() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	suite.Empty(props.Keys(ctx))
+
+	props.Add(ctx, "title", "Keys")
+	props.Add(ctx, "draft", true)
+	props.Add(ctx, "author", "Jane")
+	props.Delete(ctx, "draft")
+	suite.Equal([]PropertyName{"title", "author"}, props.Keys(ctx), "Keys should follow insertion order")
+	suite.Equal([]interface{}{"Keys", "Jane"}, props.Values(ctx), "Values should line up with Keys")
+}
+
+func (suite *PropertiesSuite) TestHas() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "draft", true)
+	suite.True(props.Has(ctx, "draft"))
+	suite.False(props.Has(ctx, "title"))
+
+	props.Delete(ctx, "draft")
+	suite.False(props.Has(ctx, "draft"), "Deleted properties shouldn't exist")
+}
+
+func (suite *PropertiesSuite) TestAddMapCancellation() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	items := make(map[string]interface{})
+	texts := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		items[fmt.Sprintf("p%d", i)] = i
+		texts[fmt.Sprintf("p%d", i)] = strconv.Itoa(i)
+	}
+
+	added := 0
+	props := suite.factory.EmptyMutable(ctx)
+	count, err := props.AddMap(ctx, items, func(ctx context.Context, name string, value interface{}, prop Property, options ...interface{}) (Property, bool, error) {
+		if added++; added == 3 {
+			cancel()
+		}
+		return prop, true, nil
+	})
+	suite.True(errors.Is(err, context.Canceled), "The context error should be returned")
+	suite.Equal(uint(3), count, "The loop should stop right after the cancellation")
+	suite.Equal(uint(3), props.Size(ctx))
+
+	count, err = suite.factory.EmptyMutable(ctx).AddTextMap(ctx, texts, nil)
+	suite.True(errors.Is(err, context.Canceled), "A canceled context shouldn't add anything")
+	suite.Equal(uint(0), count)
+}
+
+func (suite *PropertiesSuite) TestNumberParser() {
+	ctx := context.Background()
+	european := SeparatorNumberParser{Thousands: ".", Decimal: ","}
+	pf := suite.factory.PropertyFactory(ctx)
+
+	prop, _, err := pf.FromText(ctx, "price", "1.234,56", european)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(NumericText("1234.56"), prop.AnyValue(ctx))
+
+	prop, _, _ = pf.FromText(ctx, "visitors", "-12.345.678", european)
+	suite.Equal(int64(-12345678), prop.AnyValue(ctx))
+
+	prop, _, _ = pf.FromText(ctx, "version", "1.23,4.5", european)
+	suite.Equal("1.23,4.5", prop.AnyValue(ctx), "Invalid grouping should stay text")
+
+	prop, _, _ = pf.FromText(ctx, "price", "1.234,56")
+	suite.Equal("1.234,56", prop.AnyValue(ctx), "The default stays Go-standard")
+
+	configured := &DefaultPropertyFactory{NumberParser: european}
+	prop, _, _ = configured.FromText(ctx, "total", "9.999")
+	suite.Equal(int64(9999), prop.AnyValue(ctx), "The factory's parser should be used")
+}
+
+func (suite *PropertiesSuite) TestDateParseOptions() {
+	ctx := context.Background()
+	pf := suite.factory.PropertyFactory(ctx)
+
+	prop, _, _ := pf.FromText(ctx, "published", "2019-03-04", ParseOptions{DateLayouts: []string{"2006-01-02"}})
+	suite.Equal(KindDateTime, KindOf(ctx, prop))
+
+	prop, _, _ = pf.FromText(ctx, "code", "01/02/03", ParseOptions{DateLayouts: []string{"2006-01-02"}})
+	suite.Equal("01/02/03", prop.AnyValue(ctx), "Only the allowed layouts should be parsed as dates")
+
+	prop, _, _ = pf.FromText(ctx, "published", "2019-03-04", ParseOptions{DisableDates: true})
+	suite.Equal("2019-03-04", prop.AnyValue(ctx), "Dates should stay text when disabled")
+
+	prop, _, _ = pf.FromText(ctx, "code", "01/02/03")
+	suite.Equal(KindDateTime, KindOf(ctx, prop), "The default stays permissive")
+}
+
+func (suite *PropertiesSuite) TestNumericTextIsNotADate() {
+	ctx := context.Background()
+	pf := suite.factory.PropertyFactory(ctx)
+
+	for _, value := range []string{"2024", "20240101", "1700000000"} {
+		prop, _, _ := pf.FromText(ctx, "year", value)
+		suite.Equal(KindCardinal, KindOf(ctx, prop), "%q should be a cardinal", value)
+	}
+	for _, value := range []string{"3.14", "-0.5"} {
+		prop, _, _ := pf.FromText(ctx, "ratio", value)
+		suite.NotEqual(KindDateTime, KindOf(ctx, prop), "%q shouldn't be a date", value)
+	}
+	for _, value := range []string{"2024-01-01", "2006-01-02T15:04:05Z", "March 4, 2019"} {
+		prop, _, _ := pf.FromText(ctx, "published", value)
+		suite.Equal(KindDateTime, KindOf(ctx, prop), "%q should be a date", value)
+	}
+}
+
+func (suite *PropertiesSuite) TestAddProperties() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx, rejectNames{"secret"})
+	count, err := props.AddProperties(ctx, []Property{
+		&DefaultTextProperty{"title", "Bulk"},
+		&DefaultTextProperty{"secret", "hunter2"},
+		&DefaultFlagProperty{"draft", true},
+	})
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(2), count, "The add policy is honored")
+	suite.Equal([]PropertyName{"title", "draft"}, props.Keys(ctx))
+
+	count, err = props.AddProperties(ctx, []Property{
+		&DefaultTextProperty{"author", "Jane"},
+		&DefaultTextProperty{"", "nameless"},
+		&DefaultTextProperty{"summary", "never added"},
+	})
+	suite.Equal(ErrEmptyPropertyName, err)
+	suite.Equal(uint(1), count, "Adding should stop at the first error")
+	suite.False(props.Has(ctx, "summary"))
+}
+
+func (suite *PropertiesSuite) TestClear() {
+	ctx := context.Background()
+	observer := &recordingObserver{}
+	props := suite.factory.EmptyMutable(ctx, observer)
+	title, _, _ := props.Add(ctx, "title", "Pooled")
+	draft, _, _ := props.Add(ctx, "draft", true)
+
+	suite.Equal(uint(2), props.Clear(ctx))
+	suite.Equal(uint(0), props.Size(ctx))
+	suite.Nil(props.(*Default).verifySize(ctx))
+	suite.Empty(props.Keys(ctx))
+	suite.Equal([]Property{title, draft}, observer.deleted, "Each removed property should be announced")
+	suite.Equal(uint(0), props.Clear(ctx), "Clearing an empty instance removes nothing")
+
+	props.Add(ctx, "title", "Reused")
+	suite.Equal([]PropertyName{"title"}, props.Keys(ctx), "The instance should be reusable")
+}
+
+func (suite *PropertiesSuite) TestRejectEmptyNames() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	count, err := props.AddMap(ctx, map[string]interface{}{"title": "Named", "": "empty", "  ": "blank"}, RejectEmptyNames)
+	suite.Nil(err, "Blank names should be skipped rather than failing")
+	suite.Equal(uint(1), count)
+	suite.Equal([]PropertyName{"title"}, props.Keys(ctx))
+}
+
+func (suite *PropertiesSuite) TestCaseInsensitiveNames() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx, LowercaseNames)
+	props.Add(ctx, "Title", "First")
+	props.Add(ctx, "tags", []string{"Go"})
+
+	title, ok := GetString(ctx, props, "TITLE")
+	suite.True(ok, "Lookups should ignore case")
+	suite.Equal("First", title)
+	suite.True(props.HasListValue(ctx, "Tags", "Go"))
+
+	props.Add(ctx, "title", "Second")
+	suite.Equal(uint(2), props.Size(ctx), "Names differing in case are the same property")
+	title, _ = GetString(ctx, props, "Title")
+	suite.Equal("Second", title)
+
+	deleted, _ := props.Delete(ctx, "TITLE")
+	suite.True(deleted)
+	suite.False(props.Has(ctx, "title"))
+
+	exact := suite.factory.EmptyMutable(ctx)
+	exact.Add(ctx, "Title", "Exact")
+	suite.False(exact.Has(ctx, "title"), "Names are case-sensitive by default")
+}
+
+func (suite *PropertiesSuite) TestNameAliases() {
+	ctx := context.Background()
+	aliases := NameAliases(map[string]string{"desc": "description", "tags": "keywords"})
+	props := suite.factory.EmptyMutable(ctx, aliases)
+
+	prop, _, _ := props.Add(ctx, "desc", "Aliased")
+	suite.Equal(PropertyName("description"), prop.Name(ctx), "The created property should have the canonical name")
+	props.AddParsed(ctx, "tags", "go")
+	suite.Equal([]PropertyName{"description", "keywords"}, props.Keys(ctx))
+
+	desc, ok := GetString(ctx, props, "desc")
+	suite.True(ok, "Lookups should resolve through the aliases")
+	suite.Equal("Aliased", desc)
+
+	factory := &DefaultPropertiesFactory{PropFactory: suite.factory.PropertyFactory(ctx), NameAlias: aliases}
+	combined := factory.EmptyMutable(ctx, LowercaseNames)
+	combined.AddMap(ctx, map[string]interface{}{"desc": "From the factory"}, nil)
+	suite.True(combined.Has(ctx, "DESCRIPTION"), "Factory aliases combine with normalization")
+}
+
+func (suite *PropertiesSuite) TestMergeYAMLDocuments() {
+	ctx := context.Background()
+	content := "---\ntitle: First\nauthor: Jane\n---\ntitle: Second\ndraft: true\n---\nBody\n\n---\n\nAfter a rule"
+
+	bodyBytes, props, count, err := suite.factory.MutableFromFrontMatter(ctx, []byte(content), nil, MergeYAMLDocuments)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(3), count)
+	suite.Equal("Second", MustGetString(ctx, props, "title"), "Later documents should win")
+	suite.Equal([]PropertyName{"title", "author", "draft"}, props.Keys(ctx))
+	suite.Equal("Body\n\n---\n\nAfter a rule", string(bodyBytes), "A block which isn't a mapping is body")
+
+	bodyBytes, props, _, err = suite.factory.MutableFromFrontMatter(ctx, []byte(content), nil)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal("First", MustGetString(ctx, props, "title"), "Only the first document is read by default")
+	suite.True(strings.HasPrefix(string(bodyBytes), "title: Second"))
+}
+
+func (suite *PropertiesSuite) TestToJSON() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "title", "JSON")
+	props.Add(ctx, "count", 3)
+	props.Add(ctx, "tags", []string{"a", "b"})
+	props.Add(ctx, "author", map[string]interface{}{"name": "Jane"})
+
+	b, err := ToJSON(ctx, props)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(`{"title":"JSON","count":3,"tags":["a","b"],"author":{"name":"Jane"}}`, string(b), "Names should keep insertion order")
+
+	b, err = json.Marshal(map[string]interface{}{"page": props})
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(`{"page":{"title":"JSON","count":3,"tags":["a","b"],"author":{"name":"Jane"}}}`, string(b))
+}
+
+func (suite *PropertiesSuite) TestMutableFromJSON() {
+	ctx := context.Background()
+	props, count, err := suite.factory.MutableFromJSON(ctx, []byte(`{"title": "JSON", "count": 3, "ratio": 0.50, "tags": ["a", "b"]}`), nil)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(uint(4), count)
+	suite.Equal([]PropertyName{"title", "count", "ratio", "tags"}, props.Keys(ctx), "Declaration order should be kept")
+	suite.Equal(int64(3), MustGetInt(ctx, props, "count"), "Integral numbers should be cardinals, not float64")
+	ratio, _ := props.Named(ctx, "ratio")
+	suite.Equal(NumericText("0.50"), ratio.AnyValue(ctx))
+
+	b, err := ToJSON(ctx, props)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(`{"title":"JSON","count":3,"ratio":0.50,"tags":["a","b"]}`, string(b), "JSON should round trip")
+
+	_, _, err = suite.factory.MutableFromJSON(ctx, []byte(`{"title": "JSON"} {}`), nil)
+	suite.NotNil(err, "Trailing content should be an error")
+	_, _, err = suite.factory.MutableFromJSON(ctx, []byte(`["not", "an", "object"]`), nil)
+	suite.NotNil(err, "Only objects can be decoded")
+}
+
+func (suite *PropertiesSuite) TestEqual() {
+	ctx := context.Background()
+	when := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+	suite.True(Equal(ctx, &DefaultDateTimeProperty{"date", when}, &DefaultDateTimeProperty{"date", when.In(time.FixedZone("CET", 3600))}), "Date times should be compared as instants")
+	suite.True(Equal(ctx, &DefaultTextListProperty{"tags", []string{"a", "b"}}, &DefaultTextListProperty{"tags", []string{"a", "b"}}))
+	suite.False(Equal(ctx, &DefaultTextListProperty{"tags", []string{"a", "b"}}, &DefaultTextListProperty{"tags", []string{"b", "a"}}))
+	suite.True(Equal(ctx, &DefaultNumericTextProperty{"price", "3.50"}, &DefaultNumericTextProperty{"price", "3.5"}), "Numbers should be compared by value")
+	suite.True(Equal(ctx, &DefaultCardinalProperty{"count", 3}, &DefaultNumericTextProperty{"count", "3"}))
+	suite.False(Equal(ctx, &DefaultTextProperty{"count", "3"}, &DefaultCardinalProperty{"count", 3}), "Text isn't a number")
+	suite.False(Equal(ctx, &DefaultTextProperty{"a", "x"}, &DefaultTextProperty{"b", "x"}), "Names should match")
+	suite.True(Equal(ctx, nil, nil))
+}
+
+func (suite *PropertiesSuite) TestAfterCreateHookForCustomTypes() {
+	ctx := context.Background()
+	var hooked []PropertyName
+	pf := &DefaultPropertyFactory{AfterCreateHookFunc: func(ctx context.Context, prop Property, options ...interface{}) (Property, bool, error) {
+		hooked = append(hooked, prop.Name(ctx))
+		return prop, true, nil
+	}}
+	custom := CustomCreatorFunc(func(ctx context.Context, name string, value interface{}, options ...interface{}) (Property, bool, error) {
+		return &DefaultTextProperty{PropertyName(name), fmt.Sprintf("%T", value)}, true, nil
+	})
+
+	pf.FromAny(ctx, "text", "known")
+	prop, ok, err := pf.FromAny(ctx, "custom", suite, custom)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.True(ok)
+	suite.Equal("*properties.PropertiesSuite", prop.AnyValue(ctx))
+	suite.Equal([]PropertyName{"text", "custom"}, hooked, "The hook should run for custom types too")
+}
+
+func (suite *PropertiesSuite) TestMapOrdered() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "zeta", "last alphabetically")
+	props.Add(ctx, "alpha", 1)
+	props.Add(ctx, "zeta", "replaced")
+
+	suite.Equal([]KeyValue{{"zeta", "replaced"}, {"alpha", int64(1)}}, props.MapOrdered(ctx), "Replacing keeps the original position")
+}
+
+func (suite *PropertiesSuite) TestBigIntegers() {
+	ctx := context.Background()
+	pf := suite.factory.PropertyFactory(ctx)
+	huge := "1234567890123456789012345"
+
+	prop, _, _ := pf.FromText(ctx, "id", huge)
+	suite.Equal(huge, prop.AnyValue(ctx), "Out of range integers stay text by default")
+
+	prop, _, _ = pf.FromText(ctx, "id", huge, ParseOptions{BigInts: true})
+	suite.Equal(KindBigInt, KindOf(ctx, prop))
+	suite.Equal(huge, prop.(BigIntProperty).Value(ctx).String())
+
+	prop, _, _ = pf.FromText(ctx, "id", "42", ParseOptions{BigInts: true})
+	suite.Equal(KindCardinal, KindOf(ctx, prop), "Integers in range are still cardinals")
+
+	props := suite.factory.EmptyMutable(ctx)
+	props.AddParsed(ctx, "id", huge, ParseOptions{BigInts: true})
+	b, err := ToJSON(ctx, props)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal(`{"id":"`+huge+`"}`, string(b), "Big integers should be encoded as JSON strings")
+}
+
+func (suite *PropertiesSuite) TestIntegerLiterals() {
+	ctx := context.Background()
+	pf := suite.factory.PropertyFactory(ctx)
+
+	for text, expected := range map[string]int64{"-5": -5, "+5": 5, "0017": 17} {
+		prop, _, _ := pf.FromText(ctx, "number", text)
+		suite.Equal(expected, prop.AnyValue(ctx), "%q should be a base 10 cardinal", text)
+	}
+	prop, _, _ := pf.FromText(ctx, "number", "0x1F")
+	suite.Equal("0x1F", prop.AnyValue(ctx), "Hexadecimal stays text by default")
+
+	literals := ParseOptions{IntegerLiterals: true}
+	for text, expected := range map[string]int64{"0x1F": 31, "0o17": 15, "0b101": 5, "-0x10": -16, "+5": 5} {
+		prop, _, _ := pf.FromText(ctx, "number", text, literals)
+		suite.Equal(expected, prop.AnyValue(ctx), "%q should be parsed as a Go literal", text)
+	}
+}
+
+func (suite *PropertiesSuite) TestTextListSplitFrontMatter() {
+	ctx := context.Background()
+	content := "---\ntags: go , yaml,, front matter\ncategory: go\nempty: \",,\"\n---\nBody"
+
+	_, props, _, err := suite.factory.MutableFromFrontMatter(ctx, []byte(content), nil, TextListSplit{Delimiter: ","})
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal([]string{"go", "yaml", "front matter"}, MustGetStringList(ctx, props, "tags"), "Elements should be trimmed and empty ones dropped")
+	suite.Equal("go", MustGetString(ctx, props, "category"), "Text without the delimiter stays text")
+	suite.Equal(",,", MustGetString(ctx, props, "empty"), "Text with only empty elements stays text")
+
+	_, props, _, err = suite.factory.MutableFromFrontMatter(ctx, []byte(content), nil)
+	suite.Nil(err, "Shouldn't have any errors")
+	suite.Equal("go , yaml,, front matter", MustGetString(ctx, props, "tags"), "Text isn't split by default")
+
+	prop, _, _ := suite.factory.PropertyFactory(ctx).FromText(ctx, "tags", "a;b", TextListSplit{Delimiter: ";"})
+	suite.Equal([]string{"a", "b"}, prop.AnyValue(ctx))
+}
+
+func (suite *PropertiesSuite) TestSetAnyValue() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "count", int64(1))
+	props.Add(ctx, "tags", []string{"go"})
+
+	count, _ := props.Named(ctx, "count")
+	suite.Nil(SetAnyValue(ctx, count, 5))
+	number, _ := GetInt(ctx, props, "count")
+	suite.Equal(int64(5), number, "The stored property should be updated in place")
+
+	err := SetAnyValue(ctx, count, "five")
+	suite.True(errors.Is(err, ErrValueType))
+	suite.Contains(err.Error(), "int64")
+
+	suite.True(props.HasListValue(ctx, "tags", "go"))
+	tags, _ := props.Named(ctx, "tags")
+	suite.Nil(SetAnyValue(ctx, tags, []string{"yaml"}))
+	suite.False(props.HasListValue(ctx, "tags", "go"), "The list index should notice the new value")
+	suite.True(props.HasListValue(ctx, "tags", "yaml"))
+
+	clone := props.Clone(ctx)
+	cloned, _ := clone.Named(ctx, "count")
+	suite.Nil(SetAnyValue(ctx, cloned, 6))
+	number, _ = GetInt(ctx, props, "count")
+	suite.Equal(int64(5), number, "Setting a clone's property shouldn't change the source")
+	number, _ = GetInt(ctx, clone, "count")
+	suite.Equal(int64(6), number)
+
+	cow := NewCopyOnWrite(ctx, suite.factory, props)
+	read, _ := cow.Named(ctx, "count")
+	suite.Nil(SetAnyValue(ctx, read, 7))
+	suite.Nil(SetAnyValue(ctx, cow.List(ctx)[1], []string{"toml"}))
+	number, _ = GetInt(ctx, props, "count")
+	suite.Equal(int64(5), number, "Setting a copy-on-write read shouldn't change the shared base")
+	suite.True(props.HasListValue(ctx, "tags", "yaml"), "Setting a copy-on-write read shouldn't change the shared base")
+}
+
+func (suite *PropertiesSuite) TestRecount() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "title", "Hello")
+	props.Add(ctx, "draft", true)
+
+	atomic.StoreInt64(&props.(*Default).syncMapSize, 7)
+	suite.Error(props.(*Default).verifySize(ctx))
+	suite.Equal(uint(2), props.Recount(ctx), "Recount should return the number of stored properties")
+	suite.Equal(uint(2), props.Size(ctx))
+	suite.Nil(props.(*Default).verifySize(ctx))
+}
+
+func (suite *PropertiesSuite) TestFilterByType() {
+	ctx := context.Background()
+	props := suite.factory.EmptyMutable(ctx)
+	props.Add(ctx, "title", "Hello")
+	props.Add(ctx, "draft", true)
+	props.Add(ctx, "published", time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC))
+	props.Add(ctx, "featured", false, TrackOrigin)
+	props.AddProperty(ctx, &DefaultExpiringProperty{&DefaultFlagProperty{"pinned", true}, time.Now().Add(time.Hour)})
+	props.AddProperty(ctx, WithProvenance(ctx, nil, &DefaultFlagProperty{"hidden", false}, "defaulted"))
+
+	flags := props.FilterByType(ctx, KindFlag)
+	suite.Len(flags, 4, "Wrapped properties should be classified by their value")
+	suite.Equal(PropertyName("draft"), flags[0].Name(ctx))
+	suite.IsType(&DefaultOriginProperty{}, flags[1])
+	suite.IsType(&DefaultExpiringProperty{}, flags[2])
+	suite.IsType(&DefaultProvenanceProperty{}, flags[3])
+	suite.Len(props.FilterByType(ctx, KindDateTime), 1)
+	suite.Empty(props.FilterByType(ctx, KindURL))
+
+	typed := ExtractTyped(ctx, props)
+	suite.Equal(map[string]bool{"draft": true, "featured": false, "pinned": true, "hidden": false}, typed.Flags)
+}
+
 func TestSuite(t *testing.T) {
 	suite.Run(t, new(PropertiesSuite))
 }
+
+func benchmarkProperties(b *testing.B, size int) Properties {
+	ctx := context.Background()
+	props := ThePropertiesFactory.EmptyMutable(ctx)
+	for i := 0; i < size; i++ {
+		props.Add(ctx, fmt.Sprintf("prop%d", i), i)
+	}
+	return props
+}
+
+func BenchmarkList(b *testing.B) {
+	ctx := context.Background()
+	props := benchmarkProperties(b, 100)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = props.List(ctx)
+	}
+}
+
+func BenchmarkInto(b *testing.B) {
+	ctx := context.Background()
+	props := benchmarkProperties(b, 100)
+	dst := make([]Property, 0, props.Size(ctx))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dst = props.Into(ctx, dst[:0])
+	}
+}
+
+func BenchmarkListLarge(b *testing.B) {
+	ctx := context.Background()
+	props := benchmarkProperties(b, 10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = props.List(ctx)
+	}
+}
+
+func BenchmarkFilterLarge(b *testing.B) {
+	ctx := context.Background()
+	props := benchmarkProperties(b, 10000)
+	all := func(context.Context, Property) bool { return true }
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = props.Filter(ctx, all)
+	}
+}
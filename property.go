@@ -2,7 +2,14 @@ package properties
 
 import (
 	"context"
+	"encoding/json"
+	"math/big"
+	"net/url"
+	"reflect"
+	"strconv"
 	"time"
+
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 // PropertyName is the name of a property
@@ -12,6 +19,7 @@ type PropertyName string
 type Property interface {
 	Name(context.Context) PropertyName
 	AnyValue(context.Context) interface{}
+	JSONValue(context.Context) interface{}
 	Copy(context.Context, map[string]interface{}, ...interface{})
 }
 
@@ -45,6 +53,193 @@ type CardinalProperty interface {
 	Value(context.Context) int64
 }
 
+// DurationProperty holds a named elapsed time such as "7m" or "2h30m"
+type DurationProperty interface {
+	Property
+	Value(context.Context) time.Duration
+}
+
+// URLProperty holds a named absolute URL
+type URLProperty interface {
+	Property
+	Value(context.Context) *url.URL
+}
+
+// BigIntProperty holds a named integer which doesn't fit in an int64
+type BigIntProperty interface {
+	Property
+	Value(context.Context) *big.Int
+}
+
+// CardinalListProperty holds a named cardinal slice
+type CardinalListProperty interface {
+	Property
+	Value(context.Context) []int64
+}
+
+// FloatListProperty holds a named floating point slice
+type FloatListProperty interface {
+	Property
+	Value(context.Context) []float64
+}
+
+// MapProperty holds a named nested map, e.g. an "author" object with its own name and email
+type MapProperty interface {
+	Property
+	Value(context.Context) map[string]interface{}
+	AsProperties(context.Context, Factory, ...interface{}) (Properties, error)
+}
+
+// NestedProperty is a MapProperty whose nested values are themselves typed properties, e.g. the "name" and
+// "email" of an "author" object in front matter
+type NestedProperty interface {
+	MapProperty
+	Nested(context.Context) Properties
+}
+
+// NumericText is a number kept in its original textual form (e.g. "3.50") so that serialization reproduces it exactly
+type NumericText string
+
+// Float64 returns the numeric value of the text
+func (n NumericText) Float64() (float64, error) {
+	return strconv.ParseFloat(string(n), 64)
+}
+
+// MarshalJSON emits the original text as a JSON number, or as a JSON string when the text isn't valid as a JSON
+// number (e.g. "3,50", "+5" or "0x1F")
+func (n NumericText) MarshalJSON() ([]byte, error) {
+	text := []byte(n)
+	if len(text) > 0 && (text[0] == '-' || (text[0] >= '0' && text[0] <= '9')) && json.Valid(text) {
+		return text, nil
+	}
+	return json.Marshal(string(n))
+}
+
+// MarshalYAML emits the original text as a plain float scalar when encoded with gopkg.in/yaml.v3
+func (n NumericText) MarshalYAML() (interface{}, error) {
+	return &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!float", Value: string(n)}, nil
+}
+
+// NumericTextProperty holds a named number which keeps its original textual formatting
+type NumericTextProperty interface {
+	Property
+	Value(context.Context) NumericText
+	Float64(context.Context) float64
+}
+
+// DefaultCardinalListProperty implements CardinalListProperty
+type DefaultCardinalListProperty struct {
+	PropName PropertyName `json:"name"`
+	Slice    []int64      `json:"value"`
+}
+
+// Copy copies the key/value pair into the given map
+func (p *DefaultCardinalListProperty) Copy(ctx context.Context, m map[string]interface{}, options ...interface{}) {
+	m[string(p.PropName)] = p.Slice
+}
+
+// Name returns the property name
+func (p *DefaultCardinalListProperty) Name(context.Context) PropertyName {
+	return p.PropName
+}
+
+// AnyValue returns the property value useful when the type isn't important
+func (p *DefaultCardinalListProperty) AnyValue(context.Context) interface{} {
+	return p.Slice
+}
+
+// JSONValue returns the property value in a form that is safe and canonical for encoding/json
+func (p *DefaultCardinalListProperty) JSONValue(context.Context) interface{} {
+	return p.Slice
+}
+
+// Value returns the property value when the type is important
+func (p *DefaultCardinalListProperty) Value(context.Context) []int64 {
+	return p.Slice
+}
+
+// DefaultFloatListProperty implements FloatListProperty
+type DefaultFloatListProperty struct {
+	PropName PropertyName `json:"name"`
+	Slice    []float64    `json:"value"`
+}
+
+// Copy copies the key/value pair into the given map
+func (p *DefaultFloatListProperty) Copy(ctx context.Context, m map[string]interface{}, options ...interface{}) {
+	m[string(p.PropName)] = p.Slice
+}
+
+// Name returns the property name
+func (p *DefaultFloatListProperty) Name(context.Context) PropertyName {
+	return p.PropName
+}
+
+// AnyValue returns the property value useful when the type isn't important
+func (p *DefaultFloatListProperty) AnyValue(context.Context) interface{} {
+	return p.Slice
+}
+
+// JSONValue returns the property value in a form that is safe and canonical for encoding/json
+func (p *DefaultFloatListProperty) JSONValue(context.Context) interface{} {
+	return p.Slice
+}
+
+// Value returns the property value when the type is important
+func (p *DefaultFloatListProperty) Value(context.Context) []float64 {
+	return p.Slice
+}
+
+// ExpiringProperty holds a named value which is only valid until its expiry time
+type ExpiringProperty interface {
+	Property
+	ExpiresAt(context.Context) time.Time
+}
+
+// Expired returns true if the property is an ExpiringProperty whose expiry time has passed according to Now(ctx)
+func Expired(ctx context.Context, p Property) bool {
+	if expiring, ok := p.(ExpiringProperty); ok {
+		return !Now(ctx).Before(expiring.ExpiresAt(ctx))
+	}
+	return false
+}
+
+// Equal returns true if both properties have the same name and type-aware equal values: date times are compared
+// with time.Time.Equal, numbers by numeric value (so NumericText "3.50" equals "3.5" and a cardinal 3 equals "3") and
+// everything else, including text and lists, with reflect.DeepEqual
+func Equal(ctx context.Context, a, b Property) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Name(ctx) != b.Name(ctx) {
+		return false
+	}
+
+	aValue, bValue := a.AnyValue(ctx), b.AnyValue(ctx)
+	if aTime, ok := aValue.(time.Time); ok {
+		bTime, ok := bValue.(time.Time)
+		return ok && aTime.Equal(bTime)
+	}
+	if reflect.DeepEqual(aValue, bValue) {
+		return true
+	}
+	aNumber, aOk := numericValue(aValue)
+	bNumber, bOk := numericValue(bValue)
+	return aOk && bOk && aNumber == bNumber
+}
+
+// numericValue returns the value of a cardinal or numeric text as a float64
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case NumericText:
+		number, err := v.Float64()
+		return number, err == nil
+	default:
+		return 0, false
+	}
+}
+
 // DefaultDateTimeProperty implements DateTimeProperty
 type DefaultDateTimeProperty struct {
 	PropName PropertyName `json:"name"`
@@ -66,6 +261,11 @@ func (p *DefaultDateTimeProperty) AnyValue(context.Context) interface{} {
 	return p.Time
 }
 
+// JSONValue returns the property value as an RFC3339 string for encoding/json
+func (p *DefaultDateTimeProperty) JSONValue(context.Context) interface{} {
+	return p.Time.Format(time.RFC3339)
+}
+
 // Value returns the property value when the type is important
 func (p *DefaultDateTimeProperty) Value(context.Context) time.Time {
 	return p.Time
@@ -92,6 +292,11 @@ func (p *DefaultFlagProperty) AnyValue(context.Context) interface{} {
 	return p.Flag
 }
 
+// JSONValue returns the property value in a form that is safe and canonical for encoding/json
+func (p *DefaultFlagProperty) JSONValue(context.Context) interface{} {
+	return p.Flag
+}
+
 // Value returns the property value when the type is important
 func (p *DefaultFlagProperty) Value(context.Context) bool {
 	return p.Flag
@@ -118,11 +323,116 @@ func (p *DefaultCardinalProperty) AnyValue(context.Context) interface{} {
 	return p.Number
 }
 
+// JSONValue returns the property value in a form that is safe and canonical for encoding/json
+func (p *DefaultCardinalProperty) JSONValue(context.Context) interface{} {
+	return p.Number
+}
+
 // Value returns the property value when the type is important
 func (p *DefaultCardinalProperty) Value(context.Context) int64 {
 	return p.Number
 }
 
+// DefaultDurationProperty implements DurationProperty
+type DefaultDurationProperty struct {
+	PropName PropertyName  `json:"name"`
+	Duration time.Duration `json:"value"`
+}
+
+// Copy copies the key/value pair into the given map
+func (p *DefaultDurationProperty) Copy(ctx context.Context, m map[string]interface{}, options ...interface{}) {
+	m[string(p.PropName)] = p.Duration
+}
+
+// Name returns the property name
+func (p *DefaultDurationProperty) Name(context.Context) PropertyName {
+	return p.PropName
+}
+
+// AnyValue returns the property value useful when the type isn't important
+func (p *DefaultDurationProperty) AnyValue(context.Context) interface{} {
+	return p.Duration
+}
+
+// JSONValue returns the property value in a form that is safe and canonical for encoding/json (e.g. "2h30m0s")
+func (p *DefaultDurationProperty) JSONValue(context.Context) interface{} {
+	return p.Duration.String()
+}
+
+// Value returns the property value when the type is important
+func (p *DefaultDurationProperty) Value(context.Context) time.Duration {
+	return p.Duration
+}
+
+// DefaultURLProperty implements URLProperty
+type DefaultURLProperty struct {
+	PropName PropertyName `json:"name"`
+	URL      *url.URL     `json:"value"`
+}
+
+// Copy copies the key/value pair into the given map
+func (p *DefaultURLProperty) Copy(ctx context.Context, m map[string]interface{}, options ...interface{}) {
+	m[string(p.PropName)] = p.URL
+}
+
+// Name returns the property name
+func (p *DefaultURLProperty) Name(context.Context) PropertyName {
+	return p.PropName
+}
+
+// AnyValue returns the property value useful when the type isn't important
+func (p *DefaultURLProperty) AnyValue(context.Context) interface{} {
+	return p.URL
+}
+
+// JSONValue returns the URL as a string for encoding/json, nil (null) if there's no URL
+func (p *DefaultURLProperty) JSONValue(context.Context) interface{} {
+	if p.URL == nil {
+		return nil
+	}
+	return p.URL.String()
+}
+
+// Value returns the property value when the type is important
+func (p *DefaultURLProperty) Value(context.Context) *url.URL {
+	return p.URL
+}
+
+// DefaultBigIntProperty implements BigIntProperty
+type DefaultBigIntProperty struct {
+	PropName PropertyName `json:"name"`
+	Int      *big.Int     `json:"value"`
+}
+
+// Copy copies the key/value pair into the given map
+func (p *DefaultBigIntProperty) Copy(ctx context.Context, m map[string]interface{}, options ...interface{}) {
+	m[string(p.PropName)] = p.Int
+}
+
+// Name returns the property name
+func (p *DefaultBigIntProperty) Name(context.Context) PropertyName {
+	return p.PropName
+}
+
+// AnyValue returns the property value useful when the type isn't important
+func (p *DefaultBigIntProperty) AnyValue(context.Context) interface{} {
+	return p.Int
+}
+
+// JSONValue returns the integer as a decimal string for encoding/json, so that consumers whose numbers are doubles
+// don't lose precision; nil (null) if there's no integer
+func (p *DefaultBigIntProperty) JSONValue(context.Context) interface{} {
+	if p.Int == nil {
+		return nil
+	}
+	return p.Int.String()
+}
+
+// Value returns the property value when the type is important
+func (p *DefaultBigIntProperty) Value(context.Context) *big.Int {
+	return p.Int
+}
+
 // DefaultTextProperty implements TextProperty
 type DefaultTextProperty struct {
 	PropName PropertyName `json:"name"`
@@ -144,11 +454,137 @@ func (p *DefaultTextProperty) AnyValue(context.Context) interface{} {
 	return p.Text
 }
 
+// JSONValue returns the property value in a form that is safe and canonical for encoding/json
+func (p *DefaultTextProperty) JSONValue(context.Context) interface{} {
+	return p.Text
+}
+
 // Value returns the property value when the type is important
 func (p *DefaultTextProperty) Value(context.Context) string {
 	return p.Text
 }
 
+// DefaultNumericTextProperty implements NumericTextProperty
+type DefaultNumericTextProperty struct {
+	PropName PropertyName `json:"name"`
+	Number   NumericText  `json:"value"`
+}
+
+// Copy copies the key/value pair into the given map
+func (p *DefaultNumericTextProperty) Copy(ctx context.Context, m map[string]interface{}, options ...interface{}) {
+	m[string(p.PropName)] = p.Number
+}
+
+// Name returns the property name
+func (p *DefaultNumericTextProperty) Name(context.Context) PropertyName {
+	return p.PropName
+}
+
+// AnyValue returns the property value useful when the type isn't important
+func (p *DefaultNumericTextProperty) AnyValue(context.Context) interface{} {
+	return p.Number
+}
+
+// JSONValue returns the property value in a form that is safe and canonical for encoding/json
+func (p *DefaultNumericTextProperty) JSONValue(context.Context) interface{} {
+	return p.Number
+}
+
+// Value returns the property value when the type is important
+func (p *DefaultNumericTextProperty) Value(context.Context) NumericText {
+	return p.Number
+}
+
+// Float64 returns the numeric value for computation, zero if the text isn't a valid number
+func (p *DefaultNumericTextProperty) Float64(context.Context) float64 {
+	number, _ := p.Number.Float64()
+	return number
+}
+
+// DefaultMapProperty implements MapProperty
+type DefaultMapProperty struct {
+	PropName PropertyName           `json:"name"`
+	Map      map[string]interface{} `json:"value"`
+}
+
+// Copy copies the key/value pair into the given map
+func (p *DefaultMapProperty) Copy(ctx context.Context, m map[string]interface{}, options ...interface{}) {
+	m[string(p.PropName)] = p.Map
+}
+
+// Name returns the property name
+func (p *DefaultMapProperty) Name(context.Context) PropertyName {
+	return p.PropName
+}
+
+// AnyValue returns the property value useful when the type isn't important
+func (p *DefaultMapProperty) AnyValue(context.Context) interface{} {
+	return p.Map
+}
+
+// JSONValue returns the property value in a form that is safe and canonical for encoding/json
+func (p *DefaultMapProperty) JSONValue(context.Context) interface{} {
+	return p.Map
+}
+
+// Value returns the property value when the type is important
+func (p *DefaultMapProperty) Value(context.Context) map[string]interface{} {
+	return p.Map
+}
+
+// AsProperties builds a standalone properties instance from the nested map so it can be processed uniformly
+func (p *DefaultMapProperty) AsProperties(ctx context.Context, factory Factory, options ...interface{}) (Properties, error) {
+	props, _, err := factory.ImmutableFromStringMap(ctx, p.Map, nil, options...)
+	return props, err
+}
+
+// DefaultNestedProperty implements NestedProperty
+type DefaultNestedProperty struct {
+	PropName PropertyName `json:"name"`
+	Props    Properties   `json:"-"`
+}
+
+// Copy copies the key and the nested properties, as a nested map, into the given map
+func (p *DefaultNestedProperty) Copy(ctx context.Context, m map[string]interface{}, options ...interface{}) {
+	m[string(p.PropName)] = p.Value(ctx)
+}
+
+// Name returns the property name
+func (p *DefaultNestedProperty) Name(context.Context) PropertyName {
+	return p.PropName
+}
+
+// AnyValue returns the property value useful when the type isn't important
+func (p *DefaultNestedProperty) AnyValue(ctx context.Context) interface{} {
+	return p.Value(ctx)
+}
+
+// JSONValue returns the property value in a form that is safe and canonical for encoding/json
+func (p *DefaultNestedProperty) JSONValue(ctx context.Context) interface{} {
+	result := make(map[string]interface{}, p.Props.Size(ctx))
+	p.Props.Range(ctx, func(ctx context.Context, prop Property) bool {
+		result[string(prop.Name(ctx))] = prop.JSONValue(ctx)
+		return true
+	})
+	return result
+}
+
+// Value returns the nested properties as a nested map
+func (p *DefaultNestedProperty) Value(ctx context.Context) map[string]interface{} {
+	result, _ := p.Props.MapSafe(ctx, DefaultMapAssign)
+	return result
+}
+
+// Nested returns the nested properties
+func (p *DefaultNestedProperty) Nested(context.Context) Properties {
+	return p.Props
+}
+
+// AsProperties returns the nested properties, they are already typed so the factory isn't used
+func (p *DefaultNestedProperty) AsProperties(context.Context, Factory, ...interface{}) (Properties, error) {
+	return p.Props, nil
+}
+
 // DefaultTextListProperty implements TextListProperty
 type DefaultTextListProperty struct {
 	PropName PropertyName `json:"name"`
@@ -170,7 +606,120 @@ func (p *DefaultTextListProperty) AnyValue(context.Context) interface{} {
 	return p.Slice
 }
 
+// JSONValue returns the property value in a form that is safe and canonical for encoding/json
+func (p *DefaultTextListProperty) JSONValue(context.Context) interface{} {
+	return p.Slice
+}
+
 // Value returns the property value when the type is important
 func (p *DefaultTextListProperty) Value(context.Context) []string {
 	return p.Slice
 }
+
+// DefaultExpiringProperty implements ExpiringProperty by wrapping another property
+type DefaultExpiringProperty struct {
+	Property
+	Expires time.Time `json:"expires"`
+}
+
+// ExpiresAt returns the time when the property is no longer valid
+func (p *DefaultExpiringProperty) ExpiresAt(context.Context) time.Time {
+	return p.Expires
+}
+
+// Unwrap returns the wrapped property, e.g. to reach its typed interface
+func (p *DefaultExpiringProperty) Unwrap() Property {
+	return p.Property
+}
+
+// PropertyOrigin describes how the factory decided a property's type
+type PropertyOrigin int
+
+const (
+	// OriginExplicit properties were created from a typed value passed to FromAny
+	OriginExplicit PropertyOrigin = iota
+	// OriginParsed properties were smart-parsed from text by FromText
+	OriginParsed
+	// OriginCustom properties were created by a custom creator
+	OriginCustom
+)
+
+func (o PropertyOrigin) String() string {
+	switch o {
+	case OriginParsed:
+		return "parsed"
+	case OriginCustom:
+		return "custom"
+	default:
+		return "explicit"
+	}
+}
+
+// Origin is implemented by properties which know how their type was decided
+type Origin interface {
+	Origin(context.Context) PropertyOrigin
+}
+
+// DefaultOriginProperty implements Origin by wrapping another property
+type DefaultOriginProperty struct {
+	Property
+	From PropertyOrigin
+}
+
+// Origin returns how the wrapped property's type was decided
+func (p *DefaultOriginProperty) Origin(context.Context) PropertyOrigin {
+	return p.From
+}
+
+// Unwrap returns the wrapped property, e.g. to reach its typed interface
+func (p *DefaultOriginProperty) Unwrap() Property {
+	return p.Property
+}
+
+// OriginOf returns the recorded origin of the property and false if none was recorded
+func OriginOf(ctx context.Context, p Property) (PropertyOrigin, bool) {
+	if annotated, ok := p.(Origin); ok {
+		return annotated.Origin(ctx), true
+	}
+	return OriginExplicit, false
+}
+
+// ProvenanceProperty holds a named value along with the trail of transformations that produced it
+type ProvenanceProperty interface {
+	Property
+	Provenance(context.Context) []string
+}
+
+// DefaultProvenanceProperty implements ProvenanceProperty by wrapping another property
+type DefaultProvenanceProperty struct {
+	Property
+	Steps []string `json:"provenance"`
+}
+
+// Provenance returns the transformation descriptions, oldest first
+func (p *DefaultProvenanceProperty) Provenance(context.Context) []string {
+	return p.Steps
+}
+
+// Unwrap returns the wrapped property, e.g. to reach its typed interface
+func (p *DefaultProvenanceProperty) Unwrap() Property {
+	return p.Property
+}
+
+// WithProvenance annotates the result of a transformation with the provenance chain of its source property plus
+// a description of the transformation step; from and to may be the same property for in-place annotations
+func WithProvenance(ctx context.Context, from Property, to Property, step string) Property {
+	steps := append(append([]string(nil), Provenance(ctx, from)...), step)
+	if wrapped, ok := to.(*DefaultProvenanceProperty); ok {
+		to = wrapped.Property
+	}
+	return &DefaultProvenanceProperty{Property: to, Steps: steps}
+}
+
+// Provenance returns the transformation descriptions recorded for the property, nil if there are none
+func Provenance(ctx context.Context, p Property) []string {
+	if annotated, ok := p.(ProvenanceProperty); ok {
+		return annotated.Provenance(ctx)
+	}
+	return nil
+}
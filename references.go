@@ -0,0 +1,167 @@
+package properties
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"unicode"
+)
+
+// TemplateFuncs are the functions available to property references resolved by ResolveReferences; a
+// template.FuncMap passed in options adds to (or overrides) these
+var TemplateFuncs = template.FuncMap{
+	"slugify": Slugify,
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"trim":    strings.TrimSpace,
+}
+
+// Slugify lowercases text and replaces every run of characters other than letters and digits with a single dash
+func Slugify(text string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && sb.Len() > 0 {
+				sb.WriteRune('-')
+			}
+			sb.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return sb.String()
+}
+
+// ResolveReferences evaluates text properties containing templates like "{{ .title | slugify }}" against the other
+// properties and replaces them with the rendered text; templates may reference other templates, but reference
+// cycles and references to missing properties are errors. It returns the number of properties resolved.
+func ResolveReferences(ctx context.Context, props MutableProperties, options ...interface{}) (uint, error) {
+	funcs := template.FuncMap{}
+	for name, fn := range TemplateFuncs {
+		funcs[name] = fn
+	}
+	for _, option := range options {
+		if instance, ok := option.(template.FuncMap); ok {
+			for name, fn := range instance {
+				funcs[name] = fn
+			}
+		}
+	}
+
+	values := make(map[string]interface{})
+	templates := make(map[string]*template.Template)
+	var order []string // the template names in the collection's order, so resolving and events are deterministic
+	for _, property := range props.List(ctx) {
+		name := string(property.Name(ctx))
+		values[name] = property.AnyValue(ctx)
+		text, ok := property.(TextProperty)
+		if !ok || !strings.Contains(text.Value(ctx), "{{") {
+			continue
+		}
+		tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text.Value(ctx))
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse %q property template: %w", name, err)
+		}
+		templates[name] = tmpl
+		order = append(order, name)
+	}
+
+	r := &referenceResolver{values: values, templates: templates, resolved: make(map[string]bool)}
+	var count uint
+	for _, name := range order {
+		if err := r.resolve(name, nil); err != nil {
+			return count, err
+		}
+	}
+	for _, name := range order {
+		if _, _, err := props.AddProperty(ctx, &DefaultTextProperty{PropertyName(name), values[name].(string)}, options...); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+type referenceResolver struct {
+	values    map[string]interface{}
+	templates map[string]*template.Template
+	resolved  map[string]bool
+}
+
+// resolve renders the named template after the templates it references, path holds the names being resolved
+func (r *referenceResolver) resolve(name string, path []string) error {
+	if r.resolved[name] {
+		return nil
+	}
+	for i, visiting := range path {
+		if visiting == name {
+			return fmt.Errorf("property reference cycle: %s -> %s", strings.Join(path[i:], " -> "), name)
+		}
+	}
+	path = append(path, name)
+
+	tmpl := r.templates[name]
+	for _, ref := range templateFieldRefs(tmpl.Tree.Root) {
+		if _, ok := r.templates[ref]; ok {
+			if err := r.resolve(ref, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, r.values); err != nil {
+		return fmt.Errorf("unable to resolve %q property: %w", name, err)
+	}
+	r.values[name] = sb.String()
+	r.resolved[name] = true
+	return nil
+}
+
+// templateFieldRefs returns the property names referenced as {{ .name }} fields anywhere in the template
+func templateFieldRefs(node parse.Node) []string {
+	var refs []string
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			refs = append(refs, templateFieldRefs(child)...)
+		}
+	case *parse.ActionNode:
+		refs = append(refs, templateFieldRefs(n.Pipe)...)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, cmd := range n.Cmds {
+			refs = append(refs, templateFieldRefs(cmd)...)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			refs = append(refs, templateFieldRefs(arg)...)
+		}
+	case *parse.FieldNode:
+		refs = append(refs, n.Ident[0])
+	case *parse.ChainNode:
+		refs = append(refs, templateFieldRefs(n.Node)...)
+	case *parse.IfNode:
+		refs = append(refs, templateFieldRefs(n.Pipe)...)
+		refs = append(refs, templateFieldRefs(n.List)...)
+		refs = append(refs, templateFieldRefs(n.ElseList)...)
+	case *parse.RangeNode:
+		refs = append(refs, templateFieldRefs(n.Pipe)...)
+		refs = append(refs, templateFieldRefs(n.List)...)
+		refs = append(refs, templateFieldRefs(n.ElseList)...)
+	case *parse.WithNode:
+		refs = append(refs, templateFieldRefs(n.Pipe)...)
+		refs = append(refs, templateFieldRefs(n.List)...)
+		refs = append(refs, templateFieldRefs(n.ElseList)...)
+	}
+	return refs
+}
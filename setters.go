@@ -0,0 +1,170 @@
+package properties
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+)
+
+// ErrValueType is returned (wrapped) when a value assigned to a property doesn't match the property's type
+var ErrValueType = errors.New("value type doesn't match the property")
+
+// MutableProperty is implemented by the Default* property types so that a property can be updated in place, e.g.
+// the stored instance returned by Named, and every holder of that instance sees the new value. Assigned text isn't
+// interned (an interning collection still gives back the values it interned when the property is replaced or
+// deleted), and assignments aren't synchronized with readers of the collection and don't consult its add policy or
+// fire its events, so use Add (which replaces and announces) for values other goroutines may be reading.
+type MutableProperty interface {
+	Property
+	SetAnyValue(context.Context, interface{}) error
+}
+
+// SetAnyValue assigns value to the property, seeing through wrappers such as DefaultOriginProperty; it returns an
+// ErrValueType error if the property isn't mutable or the value is of another type
+func SetAnyValue(ctx context.Context, prop Property, value interface{}) error {
+	mutable, ok := unwrap(prop).(MutableProperty)
+	if !ok {
+		return fmt.Errorf("%w: %q property (%T) isn't mutable", ErrValueType, prop.Name(ctx), prop)
+	}
+	return mutable.SetAnyValue(ctx, value)
+}
+
+func valueTypeError(name PropertyName, expected string, value interface{}) error {
+	return fmt.Errorf("%w: %q property holds %s, got %T", ErrValueType, name, expected, value)
+}
+
+// SetAnyValue assigns a string
+func (p *DefaultTextProperty) SetAnyValue(ctx context.Context, value interface{}) error {
+	text, ok := value.(string)
+	if !ok {
+		return valueTypeError(p.PropName, "string", value)
+	}
+	p.Text = text
+	return nil
+}
+
+// SetAnyValue assigns a []string
+func (p *DefaultTextListProperty) SetAnyValue(ctx context.Context, value interface{}) error {
+	slice, ok := value.([]string)
+	if !ok {
+		return valueTypeError(p.PropName, "[]string", value)
+	}
+	p.Slice = slice
+	return nil
+}
+
+// SetAnyValue assigns a bool
+func (p *DefaultFlagProperty) SetAnyValue(ctx context.Context, value interface{}) error {
+	flag, ok := value.(bool)
+	if !ok {
+		return valueTypeError(p.PropName, "bool", value)
+	}
+	p.Flag = flag
+	return nil
+}
+
+// SetAnyValue assigns a time.Time
+func (p *DefaultDateTimeProperty) SetAnyValue(ctx context.Context, value interface{}) error {
+	dateTime, ok := value.(time.Time)
+	if !ok {
+		return valueTypeError(p.PropName, "time.Time", value)
+	}
+	p.Time = dateTime
+	return nil
+}
+
+// SetAnyValue assigns an int64 or an int
+func (p *DefaultCardinalProperty) SetAnyValue(ctx context.Context, value interface{}) error {
+	switch number := value.(type) {
+	case int64:
+		p.Number = number
+	case int:
+		p.Number = int64(number)
+	default:
+		return valueTypeError(p.PropName, "int64", value)
+	}
+	return nil
+}
+
+// SetAnyValue assigns a time.Duration
+func (p *DefaultDurationProperty) SetAnyValue(ctx context.Context, value interface{}) error {
+	duration, ok := value.(time.Duration)
+	if !ok {
+		return valueTypeError(p.PropName, "time.Duration", value)
+	}
+	p.Duration = duration
+	return nil
+}
+
+// SetAnyValue assigns a *url.URL
+func (p *DefaultURLProperty) SetAnyValue(ctx context.Context, value interface{}) error {
+	link, ok := value.(*url.URL)
+	if !ok {
+		return valueTypeError(p.PropName, "*url.URL", value)
+	}
+	p.URL = link
+	return nil
+}
+
+// SetAnyValue assigns a *big.Int
+func (p *DefaultBigIntProperty) SetAnyValue(ctx context.Context, value interface{}) error {
+	number, ok := value.(*big.Int)
+	if !ok {
+		return valueTypeError(p.PropName, "*big.Int", value)
+	}
+	p.Int = number
+	return nil
+}
+
+// SetAnyValue assigns a NumericText
+func (p *DefaultNumericTextProperty) SetAnyValue(ctx context.Context, value interface{}) error {
+	number, ok := value.(NumericText)
+	if !ok {
+		return valueTypeError(p.PropName, "NumericText", value)
+	}
+	p.Number = number
+	return nil
+}
+
+// SetAnyValue assigns a []int64
+func (p *DefaultCardinalListProperty) SetAnyValue(ctx context.Context, value interface{}) error {
+	slice, ok := value.([]int64)
+	if !ok {
+		return valueTypeError(p.PropName, "[]int64", value)
+	}
+	p.Slice = slice
+	return nil
+}
+
+// SetAnyValue assigns a []float64
+func (p *DefaultFloatListProperty) SetAnyValue(ctx context.Context, value interface{}) error {
+	slice, ok := value.([]float64)
+	if !ok {
+		return valueTypeError(p.PropName, "[]float64", value)
+	}
+	p.Slice = slice
+	return nil
+}
+
+// SetAnyValue assigns a map[string]interface{}
+func (p *DefaultMapProperty) SetAnyValue(ctx context.Context, value interface{}) error {
+	items, ok := value.(map[string]interface{})
+	if !ok {
+		return valueTypeError(p.PropName, "map[string]interface{}", value)
+	}
+	p.Map = items
+	return nil
+}
+
+// SetAnyValue assigns the nested Properties
+func (p *DefaultNestedProperty) SetAnyValue(ctx context.Context, value interface{}) error {
+	props, ok := value.(Properties)
+	if !ok {
+		return valueTypeError(p.PropName, "Properties", value)
+	}
+	p.Props = props
+	return nil
+}
@@ -0,0 +1,227 @@
+package properties
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// WriteFrontMatter emits props as YAML front matter fenced by --- followed by body, so content read with
+// MutableFromFrontMatter can be mutated and persisted; dates are written as RFC3339 and text lists as sequences.
+// Properties are written in the order props lists them, unless a KeyOrder schema is passed in options: then the
+// listed names come first in that order and the remaining names follow sorted.
+func WriteFrontMatter(ctx context.Context, w io.Writer, props Properties, body []byte, options ...interface{}) error {
+	formatters := formattersFor(options...)
+	root := &yamlv3.Node{Kind: yamlv3.MappingNode}
+	for _, property := range frontMatterOrder(ctx, props.List(ctx, options...), options...) {
+		value, err := frontMatterNode(ctx, property, formatters)
+		if err != nil {
+			return fmt.Errorf("unable to write %q property: %w", property.Name(ctx), err)
+		}
+		root.Content = append(root.Content, &yamlv3.Node{Kind: yamlv3.ScalarNode, Value: string(property.Name(ctx))}, value)
+	}
+
+	if _, err := io.WriteString(w, "---\n"); err != nil {
+		return err
+	}
+	if len(root.Content) > 0 {
+		encoder := yamlv3.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(root); err != nil {
+			return err
+		}
+		if err := encoder.Close(); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(w, "---\n"); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// frontMatterOrder reorders the properties following a KeyOrder schema in options
+func frontMatterOrder(ctx context.Context, list []Property, options ...interface{}) []Property {
+	hasSchema := false
+	for _, option := range options {
+		if _, ok := option.(KeyOrder); ok {
+			hasSchema = true
+		}
+	}
+	if !hasSchema {
+		return list
+	}
+
+	byName := make(map[string]Property, len(list))
+	names := make([]string, 0, len(list))
+	for _, property := range list {
+		name := string(property.Name(ctx))
+		byName[name] = property
+		names = append(names, name)
+	}
+	ordered := make([]Property, 0, len(list))
+	for _, name := range orderedKeys(names, options...) {
+		ordered = append(ordered, byName[name])
+	}
+	return ordered
+}
+
+// yamlScalarTags are the tags for kinds which are written as scalars rendered by the formatter registry
+var yamlScalarTags = map[PropertyKind]string{
+	KindText:        "!!str",
+	KindFlag:        "!!bool",
+	KindDateTime:    "!!timestamp",
+	KindCardinal:    "!!int",
+	KindNumericText: "!!float",
+	KindDuration:    "!!str",
+	KindURL:         "!!str",
+	KindBigInt:      "!!int",
+}
+
+// frontMatterNode renders a single property value; scalars use the formatter registry while lists and maps keep
+// their structure, with their elements and values rendered through the registry too
+func frontMatterNode(ctx context.Context, property Property, formatters *FormatterRegistry) (*yamlv3.Node, error) {
+	kind := KindOf(ctx, unwrap(property))
+	if tag, ok := yamlScalarTags[kind]; ok {
+		text, err := formatters.Format(ctx, property)
+		if err != nil {
+			return nil, err
+		}
+		if kind == KindDateTime {
+			// a custom date layout which isn't a YAML timestamp is written as text
+			if _, err := time.Parse(time.RFC3339, text); err != nil {
+				tag = "!!str"
+			}
+		}
+		if tag != "!!str" {
+			return &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: tag, Value: text}, nil
+		}
+		property = &DefaultTextProperty{property.Name(ctx), text}
+	} else if elements, ok := listElements(ctx, property); ok {
+		node := &yamlv3.Node{Kind: yamlv3.SequenceNode, Tag: "!!seq"}
+		for _, element := range elements {
+			value, err := frontMatterNode(ctx, element, formatters)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, value)
+		}
+		return node, nil
+	} else if node, ok, err := frontMatterMapping(ctx, property, formatters); ok || err != nil {
+		return node, err
+	}
+
+	m := make(map[string]interface{}, 1)
+	property.Copy(ctx, m)
+	node := &yamlv3.Node{}
+	if err := node.Encode(m[string(property.Name(ctx))]); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// listElements returns the elements of a list property as scalar properties named after the list, false if the
+// property isn't a list
+func listElements(ctx context.Context, property Property) ([]Property, bool) {
+	name := property.Name(ctx)
+	var elements []Property
+	switch list := unwrap(property).(type) {
+	case TextListProperty:
+		for _, value := range list.Value(ctx) {
+			elements = append(elements, &DefaultTextProperty{name, value})
+		}
+	case CardinalListProperty:
+		for _, value := range list.Value(ctx) {
+			elements = append(elements, &DefaultCardinalProperty{name, value})
+		}
+	case FloatListProperty:
+		for _, value := range list.Value(ctx) {
+			elements = append(elements, &DefaultNumericTextProperty{name, NumericText(strconv.FormatFloat(value, 'g', -1, 64))})
+		}
+	default:
+		return nil, false
+	}
+	return elements, true
+}
+
+// frontMatterMapping renders a map property with each value rendered by frontMatterNode, in the nested collection's
+// order or sorted by key for plain maps; values the default property factory can't represent are encoded as they
+// are. It returns false if the property isn't a map.
+func frontMatterMapping(ctx context.Context, property Property, formatters *FormatterRegistry) (*yamlv3.Node, bool, error) {
+	node := &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+	add := func(name string, entry Property, item interface{}) error {
+		value := &yamlv3.Node{}
+		var err error
+		if entry != nil {
+			value, err = frontMatterNode(ctx, entry, formatters)
+		} else {
+			err = value.Encode(item)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to write %q value: %w", name, err)
+		}
+		node.Content = append(node.Content, &yamlv3.Node{Kind: yamlv3.ScalarNode, Value: name}, value)
+		return nil
+	}
+
+	switch value := unwrap(property).(type) {
+	case NestedProperty:
+		for _, entry := range value.Nested(ctx).List(ctx) {
+			if err := add(string(entry.Name(ctx)), entry, nil); err != nil {
+				return nil, true, err
+			}
+		}
+	case MapProperty:
+		items := value.Value(ctx)
+		keys := make([]string, 0, len(items))
+		for key := range items {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			entry, ok, err := ThePropertyFactory.FromAny(ctx, key, items[key])
+			if err != nil || !ok {
+				entry = nil
+			}
+			if err := add(key, entry, items[key]); err != nil {
+				return nil, true, err
+			}
+		}
+	default:
+		return nil, false, nil
+	}
+	return node, true, nil
+}
+
+// ToJSON encodes props as a single JSON object of name to value, using each property's JSONValue, with the names
+// in the order props lists them
+func ToJSON(ctx context.Context, props Properties, options ...interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, property := range props.List(ctx, options...) {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(string(property.Name(ctx)))
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(property.JSONValue(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode %q property: %w", property.Name(ctx), err)
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
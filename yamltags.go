@@ -0,0 +1,100 @@
+package properties
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// decodeTaggedYAML decodes front matter with gopkg.in/yaml.v3 (YAML 1.2 semantics, so a plain "yes" stays text)
+// and honors explicit !!bool, !!int, !!float and !!str scalar tags regardless of how the value looks
+func decodeTaggedYAML(b []byte) (map[string]interface{}, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	items := make(map[string]interface{})
+	if doc.Kind != yamlv3.DocumentNode || len(doc.Content) == 0 {
+		return items, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yamlv3.MappingNode {
+		return nil, fmt.Errorf("front matter is a YAML %s, not a mapping", root.ShortTag())
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, node := root.Content[i], root.Content[i+1]
+		value, err := decodeTaggedYAMLNode(node)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode %q at line %d: %v", key.Value, node.Line, err)
+		}
+		items[key.Value] = value
+	}
+	return items, nil
+}
+
+func decodeTaggedYAMLNode(node *yamlv3.Node) (interface{}, error) {
+	if node.Kind == yamlv3.ScalarNode && node.Style&yamlv3.TaggedStyle != 0 {
+		switch node.Tag {
+		case "!!bool":
+			return parseYAMLBool(node.Value)
+		case "!!int":
+			return strconv.ParseInt(node.Value, 0, 64)
+		case "!!float":
+			if _, err := strconv.ParseFloat(node.Value, 64); err != nil {
+				return nil, err
+			}
+			return NumericText(node.Value), nil
+		case "!!str":
+			return node.Value, nil
+		}
+	}
+
+	var value interface{}
+	err := node.Decode(&value)
+	return value, err
+}
+
+// parseYAMLBool accepts the YAML 1.1 boolean vocabulary since an explicit !!bool tag leaves no ambiguity
+func parseYAMLBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "y", "on":
+		return true, nil
+	case "false", "no", "n", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q is not a YAML boolean", value)
+}
+
+// yamlKeyOrder returns the keys of a YAML mapping, and of the mappings nested in it, in declaration order
+func yamlKeyOrder(b []byte) KeyOrderTree {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(b, &doc); err != nil || doc.Kind != yamlv3.DocumentNode || len(doc.Content) == 0 {
+		return KeyOrderTree{}
+	}
+	return yamlNodeKeyOrder(doc.Content[0])
+}
+
+func yamlNodeKeyOrder(node *yamlv3.Node) KeyOrderTree {
+	if node.Kind != yamlv3.MappingNode {
+		return KeyOrderTree{}
+	}
+	order := KeyOrderTree{Keys: make(KeyOrder, 0, len(node.Content)/2)}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		order.Keys = append(order.Keys, key)
+		if value.Kind == yamlv3.AliasNode {
+			value = value.Alias
+		}
+		if value.Kind == yamlv3.MappingNode {
+			if order.Nested == nil {
+				order.Nested = make(map[string]KeyOrderTree)
+			}
+			order.Nested[key] = yamlNodeKeyOrder(value)
+		}
+	}
+	return order
+}